@@ -0,0 +1,368 @@
+package relations
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ATTOptions controls the AT&T text format used by OpenFst, HFST and Foma.
+type ATTOptions struct {
+	// Epsilon is the name of the empty symbol. Empty means @0@ as in HFST
+	// and Foma. OpenFst symbol tables usually call it <eps>.
+	Epsilon string
+
+	// Numeric writes and reads symbols as their Unicode code points, 0
+	// being the empty symbol, instead of their names.
+	Numeric bool
+
+	// Symbols receives the OpenFst symbol table of the symbols written,
+	// pairing each name with its code point. Nil means no symbol table.
+	Symbols io.Writer
+
+	// MaxSymbols is the maximum number of symbols of character classes
+	// written, each of which takes a transition of its own. Zero means no
+	// limit, so that [^] alone is written as more than a million lines.
+	MaxSymbols int
+}
+
+// ErrTooManySymbols is reported by WriteATT and WriteTransducerATT when the
+// character classes have more symbols than ATTOptions.MaxSymbols.
+var ErrTooManySymbols = errors.New("character classes have too many symbols")
+
+// epsilonName returns the name of the empty symbol.
+func (o ATTOptions) epsilonName() string {
+	if o.Epsilon == "" {
+		return "@0@"
+	}
+	return o.Epsilon
+}
+
+// name returns the name of the symbol, which is epsilon for the empty one.
+// Space and tab are named as in HFST and other whitespace or invisible
+// symbols are written as \u{HEX}.
+func (o ATTOptions) name(symbol rune) string {
+	switch {
+	case o.Numeric:
+		return strconv.Itoa(int(symbol))
+	case symbol == epsilon:
+		return o.epsilonName()
+	case symbol == ' ':
+		return "@_SPACE_@"
+	case symbol == '\t':
+		return "@_TAB_@"
+	case unicode.IsSpace(symbol) || !unicode.IsGraphic(symbol):
+		return `\u{` + strings.ToUpper(strconvHex(symbol)) + `}`
+	}
+	return string(symbol)
+}
+
+// symbol returns the symbol with the given name.
+func (o ATTOptions) symbol(name string) (rune, error) {
+	if o.Numeric {
+		code, err := strconv.ParseUint(name, 10, 32)
+		if err != nil || code > unicode.MaxRune {
+			return 0, fmt.Errorf("expected a code point, found %q", name)
+		}
+		return rune(code), nil
+	}
+
+	switch name {
+	case o.epsilonName():
+		return epsilon, nil
+	case "@_SPACE_@":
+		return ' ', nil
+	case "@_TAB_@":
+		return '\t', nil
+	}
+
+	if strings.HasPrefix(name, `\u{`) && strings.HasSuffix(name, "}") {
+		code, err := strconv.ParseUint(name[3:len(name)-1], 16, 32)
+		if err == nil && code <= unicode.MaxRune {
+			return rune(code), nil
+		}
+	}
+
+	symbol, size := utf8.DecodeRuneInString(name)
+	if size != len(name) || symbol == utf8.RuneError {
+		return 0, fmt.Errorf("expected a single symbol, found %q", name)
+	}
+	return symbol, nil
+}
+
+// writeATT writes the transducer to w in AT&T text format. Each transition
+// becomes a path of transitions with one output symbol each, as do the
+// prefix and the final outputs. Transitions on a character class are
+// written for each of its symbols, unless there are more than
+// opts.MaxSymbols of them.
+func (t *transducer) writeATT(w io.Writer, opts ATTOptions) error {
+	if opts.MaxSymbols > 0 {
+		symbols := 0
+		for _, state := range t.states {
+			for _, c := range state.classes {
+				symbols += c.class.size()
+			}
+		}
+		if symbols > opts.MaxSymbols {
+			return fmt.Errorf("%w: %d symbols, at most %d",
+				ErrTooManySymbols, symbols, opts.MaxSymbols)
+		}
+	}
+
+	b := bufio.NewWriter(w)
+
+	number := map[*tState]int{t.root: 0}
+	for _, state := range t.states {
+		if _, ok := number[state]; !ok {
+			number[state] = len(number)
+		}
+	}
+	fresh := len(number)
+
+	used := map[rune]bool{}
+	name := func(symbol rune) string {
+		used[symbol] = true
+		return opts.name(symbol)
+	}
+
+	// path writes the transitions from source to target that read the
+	// input symbol and write the output.
+	path := func(source, target int, in rune, out string) {
+		runes := []rune(out)
+		if len(runes) == 0 {
+			runes = []rune{epsilon}
+		}
+		for i, symbol := range runes {
+			next := target
+			if i != len(runes)-1 {
+				next = fresh
+				fresh++
+			}
+			fmt.Fprintf(b, "%d\t%d\t%s\t%s\n", source, next, name(in), name(symbol))
+			source, in = next, epsilon
+		}
+	}
+
+	if t.prefix != "" {
+		start := fresh
+		fresh++
+		path(start, number[t.root], epsilon, t.prefix)
+	}
+
+	states := append([]*tState(nil), t.states...)
+	sort.SliceStable(states, func(i, j int) bool { return number[states[i]] < number[states[j]] })
+
+	for _, state := range states {
+		source := number[state]
+
+		symbols := make([]rune, 0, len(state.next))
+		for symbol := range state.next {
+			symbols = append(symbols, symbol)
+		}
+		sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+
+		for _, symbol := range symbols {
+			transitions := append([]*tTransition(nil), state.next[symbol]...)
+			sort.Slice(transitions, func(i, j int) bool {
+				if transitions[i].state == transitions[j].state {
+					return transitions[i].out < transitions[j].out
+				}
+				return number[transitions[i].state] < number[transitions[j].state]
+			})
+
+			for _, tr := range transitions {
+				path(source, number[tr.state], symbol, tr.out)
+			}
+		}
+
+		for _, c := range state.classes {
+			for _, r := range c.class {
+				for symbol := r.lo; symbol <= r.hi; symbol++ {
+					path(source, number[c.state], symbol, fill(c.out, c.identity, symbol))
+				}
+			}
+		}
+
+		if !state.final {
+			continue
+		}
+		if len(state.finalOut) == 0 {
+			fmt.Fprintf(b, "%d\n", source)
+		}
+		for _, o := range finalOutSet(state.finalOut) {
+			if o == "" {
+				fmt.Fprintf(b, "%d\n", source)
+				continue
+			}
+
+			// Other final outputs lead to a new final state.
+			end := fresh
+			fresh++
+			path(source, end, epsilon, o)
+			fmt.Fprintf(b, "%d\n", end)
+		}
+	}
+
+	if err := b.Flush(); err != nil {
+		return err
+	}
+
+	if opts.Symbols != nil {
+		return writeSymbolTable(opts.Symbols, used, opts)
+	}
+	return nil
+}
+
+// writeSymbolTable writes the names and code points of the used symbols and
+// the empty symbol in the format of OpenFst symbol tables.
+func writeSymbolTable(w io.Writer, used map[rune]bool, opts ATTOptions) error {
+	symbols := []rune{epsilon}
+	for symbol := range used {
+		if symbol != epsilon {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+
+	b := bufio.NewWriter(w)
+	for _, symbol := range symbols {
+		fmt.Fprintf(b, "%s\t%d\n", opts.name(symbol), symbol)
+	}
+	return b.Flush()
+}
+
+// WriteATT writes the transducer to w in the AT&T text format read by
+// OpenFst, HFST and Foma. Transitions and final outputs longer than one
+// symbol are split into paths through new states, and ranges of symbols are
+// written one transition per symbol. ErrTooManySymbols is reported when
+// there are more of those than opts.MaxSymbols.
+func (s *RegularRelation) WriteATT(w io.Writer, opts ATTOptions) error {
+	return s.transducer().writeATT(w, opts)
+}
+
+// WriteTransducerATT writes the non-deterministic transducer constructed
+// from the regular relation expression, before it is made subsequential, to
+// w in AT&T text format.
+func WriteTransducerATT(source io.Reader, w io.Writer, opts ATTOptions) error {
+	tr, err := newTransducer(source)
+	if err != nil {
+		return err
+	}
+
+	return tr.writeATT(w, opts)
+}
+
+// readATT reads a transducer in AT&T text format. The source state of the
+// first transition, or the first final state, is the root.
+func readATT(r io.Reader, opts ATTOptions) (*transducer, error) {
+	tr := &transducer{}
+	states := map[string]*tState{}
+	state := func(name string) *tState {
+		if s, ok := states[name]; ok {
+			return s
+		}
+		s := &tState{index: len(tr.states) + 1, next: map[rune][]*tTransition{}}
+		states[name] = s
+		tr.states = append(tr.states, s)
+		if tr.root == nil {
+			tr.root = s
+		}
+		return s
+	}
+
+	// weight checks that the weight does not change the relation.
+	weight := func(w string) error {
+		if f, err := strconv.ParseFloat(w, 64); err != nil || f != 0 {
+			return fmt.Errorf("expected the weight 0, found %q", w)
+		}
+		return nil
+	}
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		text, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		fields := strings.Fields(text)
+		fail := func(err error) (*transducer, error) {
+			return nil, &TableError{Line: line, Err: err}
+		}
+
+		switch len(fields) {
+		case 0:
+		case 1, 2:
+			if len(fields) == 2 {
+				if err := weight(fields[1]); err != nil {
+					return fail(err)
+				}
+			}
+			state(fields[0]).final = true
+
+		case 3, 4, 5:
+			if len(fields) == 5 {
+				if err := weight(fields[4]); err != nil {
+					return fail(err)
+				}
+			}
+			in, err := opts.symbol(fields[2])
+			if err != nil {
+				return fail(err)
+			}
+			out := in
+			if len(fields) > 3 {
+				if out, err = opts.symbol(fields[3]); err != nil {
+					return fail(err)
+				}
+			}
+
+			var output string
+			if out != epsilon {
+				output = string(out)
+			}
+			source, target := state(fields[0]), state(fields[1])
+			source.next[in] = append(source.next[in], &tTransition{state: target, out: output})
+
+		default:
+			return fail(errors.New("expected a transition or a final state"))
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if tr.root == nil {
+		state("")
+	}
+	return tr, nil
+}
+
+// ReadATT builds a RegularRelation from a transducer in AT&T text format, as
+// written by OpenFst, HFST and Foma. Each symbol is a single character, and
+// weights other than 0 are not supported. Malformed lines are reported with
+// their number in a *TableError. ErrNotSubsequential is reported if the
+// transducer is not a (p-)subsequential function.
+func ReadATT(r io.Reader, opts ATTOptions) (*RegularRelation, error) {
+	tr, err := readATT(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tr.trim()
+	if tr.hasEpsilons() {
+		if err := tr.removeEpsilons(); err != nil {
+			return nil, err
+		}
+	}
+
+	return subsequentialize(context.Background(), tr, BuildOptions{})
+}
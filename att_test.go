@@ -0,0 +1,172 @@
+package relations
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadATT(t *testing.T) {
+	// As written by HFST for cat:cats and dog:dogs.
+	source := `0	1	c	c	0.000000
+0	2	d	d	0.000000
+1	3	a	a	0.000000
+2	4	o	o	0.000000
+3	5	t	t	0.000000
+4	5	g	g	0.000000
+5	6	@0@	s	0.000000
+6	0.000000
+`
+	rr, err := ReadATT(strings.NewReader(source), ATTOptions{})
+	assert.Nil(t, err)
+
+	testTransduce(t, rr, "cat", "cats")
+	testTransduce(t, rr, "dog", "dogs")
+	_, ok := rr.Transduce("cats")
+	assert.False(t, ok)
+}
+
+func TestReadATTNumeric(t *testing.T) {
+	// As printed by OpenFst without symbol tables.
+	source := "0 1 97 0\n1 2 0 120\n1 3 0 121\n2\n3\n0 4 32 32\n4\n"
+	rr, err := ReadATT(strings.NewReader(source), ATTOptions{Numeric: true})
+	assert.Nil(t, err)
+
+	testTransduce(t, rr, "a", "x", "y")
+	testTransduce(t, rr, " ", " ")
+}
+
+func TestReadATTAcceptor(t *testing.T) {
+	rr, err := ReadATT(strings.NewReader("0 1 <eps>\n1 2 a\n2 0 b\n2\n"),
+		ATTOptions{Epsilon: "<eps>"})
+	assert.Nil(t, err)
+
+	testTransduce(t, rr, "a", "a")
+	testTransduce(t, rr, "aba", "aba")
+	_, ok := rr.Transduce("ab")
+	assert.False(t, ok)
+}
+
+func TestReadATTEmpty(t *testing.T) {
+	rr, err := ReadATT(strings.NewReader(""), ATTOptions{})
+	assert.Nil(t, err)
+	_, ok := rr.Transduce("")
+	assert.False(t, ok)
+}
+
+func TestReadATTErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{"0\t1\ta\tb\n1\t2\tab\tc\n", `line 2: expected a single symbol, found "ab"`},
+		{"0\t1\ta\tb\t1.5\n", `line 1: expected the weight 0, found "1.5"`},
+		{"0\t1.5\n", `line 1: expected the weight 0, found "1.5"`},
+		{"0\t1\ta\tb\n\n1 2 3 4 5 6\n", "line 3: expected a transition or a final state"},
+	}
+
+	for _, test := range tests {
+		_, err := ReadATT(strings.NewReader(test.source), ATTOptions{})
+		_, ok := err.(*TableError)
+		assert.True(t, ok, test.source)
+		assert.EqualError(t, err, test.message)
+	}
+
+	_, err := ReadATT(strings.NewReader("0 1 97 -1\n1\n"), ATTOptions{Numeric: true})
+	assert.EqualError(t, err, `line 1: expected a code point, found "-1"`)
+
+	_, err = ReadATT(strings.NewReader("0\t0\t@0@\tx\n0\n"), ATTOptions{})
+	assert.True(t, errors.Is(err, ErrNotSubsequential))
+}
+
+func TestWriteATT(t *testing.T) {
+	rr := buildRelation(t, `<ab,xyz>+<b,>`)
+	rr.Minimize()
+
+	var b, symbols bytes.Buffer
+	assert.Nil(t, rr.WriteATT(&b, ATTOptions{Symbols: &symbols}))
+	assert.Equal(t, `0	3	a	x
+3	4	@0@	y
+4	1	@0@	z
+0	2	b	@0@
+1	2	b	@0@
+2
+`, b.String())
+	assert.Equal(t, "@0@\t0\na\t97\nb\t98\nx\t120\ny\t121\nz\t122\n", symbols.String())
+}
+
+func TestWriteATTSymbols(t *testing.T) {
+	rr := buildRelation(t, `<a b,\u{A}\t>`)
+
+	var b bytes.Buffer
+	assert.Nil(t, rr.WriteATT(&b, ATTOptions{}))
+	assert.Contains(t, b.String(), "@_SPACE_@")
+	assert.Contains(t, b.String(), `\u{A}`)
+	assert.Contains(t, b.String(), "@_TAB_@")
+
+	b.Reset()
+	assert.Nil(t, rr.WriteATT(&b, ATTOptions{Numeric: true, Epsilon: "<eps>"}))
+	assert.Contains(t, b.String(), "1\t2\t32\t0\n")
+}
+
+func TestWriteATTMaxSymbols(t *testing.T) {
+	rr := buildRelation(t, `<a,x>[^a]*`)
+
+	var b bytes.Buffer
+	err := rr.WriteATT(&b, ATTOptions{MaxSymbols: 4096})
+	assert.True(t, errors.Is(err, ErrTooManySymbols))
+	assert.EqualError(t, err, "character classes have too many symbols: 1114110 symbols, at most 4096")
+	assert.Zero(t, b.Len())
+
+	err = WriteTransducerATT(strings.NewReader(`\p{L}`), &b, ATTOptions{MaxSymbols: 100})
+	assert.True(t, errors.Is(err, ErrTooManySymbols))
+
+	rr = buildRelation(t, `<a,x>[b-d]*`)
+	assert.Nil(t, rr.WriteATT(&b, ATTOptions{MaxSymbols: 3}))
+	assert.Contains(t, b.String(), "\td\td\n")
+}
+
+func TestATTRoundTrip(t *testing.T) {
+	expressions := []string{
+		`<ab,xyz>+<b,>`,
+		`<a,x>+<a,y>`,
+		`<,pre><a,b>*`,
+		`(<a,a>+<b,b>)*<c,cc>`,
+		`<a b,\u{A}\t>`,
+		`[a-c]<d,x>`,
+		`(<ß,ss>+<[à-å],a>)*`,
+	}
+
+	for _, options := range []ATTOptions{{}, {Numeric: true}, {Epsilon: "<eps>"}} {
+		for _, e := range expressions {
+			rr := buildRelation(t, e)
+
+			var b bytes.Buffer
+			assert.Nil(t, rr.WriteATT(&b, options))
+			read, err := ReadATT(&b, options)
+			assert.Nil(t, err, e)
+
+			for _, in := range []string{"", "a", "b", "ab", "aab", "abc", "a b",
+				"bd", "ßàå", "c", "aaa"} {
+				expected, ok := rr.Transduce(in)
+				result, readOk := read.Transduce(in)
+				assert.Equal(t, ok, readOk, e+" "+in)
+				assert.Equal(t, expected, result, e+" "+in)
+			}
+		}
+	}
+}
+
+func TestWriteTransducerATT(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteTransducerATT(strings.NewReader(`<a,x>+<a,y>`), &b, ATTOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "0\t1\ta\tx\n0\t1\ta\ty\n1\n", b.String())
+
+	read, err := ReadATT(&b, ATTOptions{})
+	assert.Nil(t, err)
+	testTransduce(t, read, "a", "x", "y")
+}
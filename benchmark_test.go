@@ -3,6 +3,8 @@ package relations
 import (
 	"bytes"
 	"math/rand"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -46,3 +48,75 @@ func BenchmarkRelations10(b *testing.B)    { benchmarkRelations(b, 10) }
 func BenchmarkRelations100(b *testing.B)   { benchmarkRelations(b, 100) }
 func BenchmarkRelations1000(b *testing.B)  { benchmarkRelations(b, 1000) }
 func BenchmarkRelations10000(b *testing.B) { benchmarkRelations(b, 10000) }
+
+func benchmarkFromPairs(b *testing.B, pairs int) {
+	words := make([]string, pairs)
+	for i := range words {
+		var w bytes.Buffer
+		writeRandomTo(&w)
+		words[i] = w.String()
+	}
+	sort.Strings(words)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		FromPairs(func(yield func(in, out string) bool) {
+			for _, word := range words {
+				if !yield(word, word) {
+					return
+				}
+			}
+		}, DictionaryOptions{})
+	}
+}
+
+func BenchmarkFromPairs10000(b *testing.B) { benchmarkFromPairs(b, 10000) }
+
+// transduceInputs returns a relation built from random words and the words.
+func transduceInputs(b *testing.B) (*RegularRelation, []string) {
+	m := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		var w bytes.Buffer
+		writeRandomTo(&w)
+		m[w.String()] = strings.ToUpper(w.String())
+	}
+	rr, err := FromMap(m)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	words := make([]string, 0, len(m))
+	for word := range m {
+		words = append(words, word)
+	}
+	return rr, words
+}
+
+func BenchmarkTransduce(b *testing.B) {
+	rr, words := transduceInputs(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		rr.Transduce(words[n%len(words)])
+	}
+}
+
+func BenchmarkAppendTransduce(b *testing.B) {
+	rr, words := transduceInputs(b)
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		buf, _ = rr.AppendTransduce(buf[:0], words[n%len(words)])
+	}
+}
+
+func BenchmarkTransducer(b *testing.B) {
+	rr, words := transduceInputs(b)
+	tr := NewTransducer(rr)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		tr.Transduce(words[n%len(words)])
+	}
+}
@@ -0,0 +1,78 @@
+package relations
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNullSymbol is reported by BuildExpr for a pair whose input or output
+// contains U+0000, which stands for the empty symbol in transducers and
+// cannot be written in the text syntax.
+var ErrNullSymbol = errors.New("pair contains the symbol U+0000")
+
+// Pair returns the expression of the pair that maps in to out. Unlike in the
+// text syntax no character has to be escaped, and an empty input makes the
+// pair an insertion. Neither side may contain U+0000.
+func Pair(in, out string) *Expr {
+	return &Expr{kind: PairExpr, in: in, out: out}
+}
+
+// Union returns the union of the expressions, grouped from the left like
+// `a+b+c` in the text syntax. The union of no expressions is the empty
+// relation, the class `[]` without symbols that relates no strings at all.
+func Union(exprs ...*Expr) *Expr {
+	if len(exprs) == 0 {
+		return &Expr{kind: ClassExpr, class: charClass{}, identity: true}
+	}
+	return leftAssociated(UnionExpr, exprs)
+}
+
+// Concat returns the concatenation of the expressions, grouped from the left
+// like `a.b.c` in the text syntax. The concatenation of no expressions is
+// the empty pair.
+func Concat(exprs ...*Expr) *Expr {
+	if len(exprs) == 0 {
+		return Pair("", "")
+	}
+	return leftAssociated(ConcatExpr, exprs)
+}
+
+// Star returns the expression repeated any number of times.
+func Star(e *Expr) *Expr {
+	return &Expr{kind: StarExpr, operands: []*Expr{e}}
+}
+
+// Optional returns the expression or the empty pair.
+func Optional(e *Expr) *Expr {
+	return &Expr{kind: OptionalExpr, operands: []*Expr{e}}
+}
+
+// OneOrMore returns the expression repeated at least once.
+func OneOrMore(e *Expr) *Expr {
+	return &Expr{kind: OneOrMoreExpr, operands: []*Expr{e}}
+}
+
+// leftAssociated joins the expressions with the binary operator of the given kind
+// from the left.
+func leftAssociated(kind ExprKind, exprs []*Expr) *Expr {
+	result := exprs[0]
+	for _, e := range exprs[1:] {
+		result = &Expr{kind: kind, operands: []*Expr{result, e}}
+	}
+	return result
+}
+
+// checkSymbols reports the first pair of the expression that contains U+0000,
+// which the lexer rejects but the constructors let through.
+func checkSymbols(e *Expr) error {
+	if e.kind == PairExpr && strings.ContainsRune(e.in+e.out, epsilon) {
+		return fmt.Errorf("%w: %s", ErrNullSymbol, e)
+	}
+	for _, o := range e.operands {
+		if err := checkSymbols(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package relations
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilderMatchesParser(t *testing.T) {
+	built := Concat(
+		Star(Union(Pair("a", ""), Pair("b", ""))),
+		Pair("a", ""), Pair("b", ""), Pair("b", ""))
+	assert.Equal(t, `(<a,>+<b,>)*.<a,>.<b,>.<b,>`, built.String())
+
+	parsed, err := computeParserMeta(strings.NewReader(`(<a,>+<b,>)*.<a,>.<b,>.<b,>`))
+	assert.Nil(t, err)
+
+	meta := exprParserMeta(built)
+	assert.Equal(t, parsed.rules, meta.rules)
+	assert.Equal(t, parsed.follow, meta.follow)
+	assert.Equal(t, parsed.rootFirst, meta.rootFirst)
+	assert.Equal(t, parsed.finalIndex, meta.finalIndex)
+}
+
+func TestBuilderNeedsNoEscaping(t *testing.T) {
+	e := Concat(Pair("a,b", "<x>"), Optional(Pair(`"\`, "")), OneOrMore(Pair("[", "]")))
+
+	rr, err := BuildExpr(context.Background(), e, BuildOptions{})
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce(`a,b"\[[`)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"<x>]]"}, out)
+
+	reparsed := parseExpr(t, e.String())
+	assert.True(t, sameTree(e, reparsed))
+}
+
+func TestBuilderEmpty(t *testing.T) {
+	assert.Equal(t, `<,>`, Concat().String())
+
+	empty := Union()
+	assert.Equal(t, ClassExpr, empty.Kind())
+	assert.Equal(t, `[]`, empty.String())
+
+	e := Concat(Pair("a", "x"), empty)
+	assert.Equal(t, `<a,x>.[]`, e.String())
+	reparsed, err := Parse(strings.NewReader(e.String()))
+	assert.Nil(t, err)
+	assert.True(t, sameTree(e, reparsed))
+
+	rr, err := BuildExpr(context.Background(), empty, BuildOptions{})
+	assert.Nil(t, err)
+	_, ok := rr.Transduce("")
+	assert.False(t, ok)
+
+	rr, err = BuildExpr(context.Background(),
+		Union(Pair("a", "x"), Concat(Pair("b", "y"), empty)), BuildOptions{})
+	assert.Nil(t, err)
+	out, ok := rr.Transduce("a")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"x"}, out)
+	_, ok = rr.Transduce("b")
+	assert.False(t, ok)
+}
+
+func TestBuilderNullSymbol(t *testing.T) {
+	for _, e := range []*Expr{
+		Pair("a\x00b", "x"),
+		Star(Concat(Pair("a", "x"), Pair("b", "\x00"))),
+	} {
+		_, err := BuildExpr(context.Background(), e, BuildOptions{})
+		assert.True(t, errors.Is(err, ErrNullSymbol), e.String())
+	}
+}
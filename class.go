@@ -0,0 +1,188 @@
+package relations
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// placeholder stands for the input symbol in the outputs of transitions on
+// character classes while they are manipulated as runes.
+const placeholder = -1
+
+// runeRange is an inclusive range of runes.
+type runeRange struct {
+	lo, hi rune
+}
+
+// charClass is a set of input symbols kept as sorted, disjoint and
+// non-adjacent ranges.
+type charClass []runeRange
+
+// newCharClass creates a character class from arbitrary ranges.
+func newCharClass(ranges ...runeRange) charClass {
+	sorted := append([]runeRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].lo < sorted[j].lo })
+
+	var class charClass
+	for _, r := range sorted {
+		if n := len(class); n != 0 && r.lo <= class[n-1].hi+1 {
+			if r.hi > class[n-1].hi {
+				class[n-1].hi = r.hi
+			}
+			continue
+		}
+		class = append(class, r)
+	}
+	return class
+}
+
+// unicodeClass creates a character class from a Unicode range table.
+func unicodeClass(table *unicode.RangeTable) charClass {
+	var ranges []runeRange
+	for _, r := range table.R16 {
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			if r.Stride == 1 {
+				ranges = append(ranges, runeRange{rune(r.Lo), rune(r.Hi)})
+				break
+			}
+			ranges = append(ranges, runeRange{c, c})
+		}
+	}
+	for _, r := range table.R32 {
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			if r.Stride == 1 {
+				ranges = append(ranges, runeRange{rune(r.Lo), rune(r.Hi)})
+				break
+			}
+			ranges = append(ranges, runeRange{c, c})
+		}
+	}
+	return newCharClass(ranges...)
+}
+
+// negate returns the symbols that are not in the class. Epsilon is never
+// part of a class.
+func (c charClass) negate() charClass {
+	var negated charClass
+	next := rune(epsilon + 1)
+	for _, r := range c {
+		if r.lo > next {
+			negated = append(negated, runeRange{next, r.lo - 1})
+		}
+		next = r.hi + 1
+	}
+	if next <= unicode.MaxRune {
+		negated = append(negated, runeRange{next, unicode.MaxRune})
+	}
+	return negated
+}
+
+// size returns the number of symbols in the class.
+func (c charClass) size() int {
+	n := 0
+	for _, r := range c {
+		n += int(r.hi-r.lo) + 1
+	}
+	return n
+}
+
+// contains reports whether the symbol is in the class.
+func (c charClass) contains(symbol rune) bool {
+	i := sort.Search(len(c), func(i int) bool { return c[i].hi >= symbol })
+	return i < len(c) && c[i].lo <= symbol
+}
+
+// String returns the class in the bracket syntax of regular expressions.
+func (c charClass) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for _, r := range c {
+		b.WriteString(classRune(r.lo))
+		if r.hi > r.lo {
+			b.WriteByte('-')
+			b.WriteString(classRune(r.hi))
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// classRune returns the rune as written inside brackets.
+func classRune(r rune) string {
+	switch {
+	case strings.ContainsRune(`[]^-\`, r):
+		return `\` + string(r)
+	case unicode.IsGraphic(r) && r != ' ':
+		return string(r)
+	}
+	return `\u{` + strings.ToUpper(strconvHex(r)) + `}`
+}
+
+// strconvHex formats the rune as a hexadecimal number.
+func strconvHex(r rune) string {
+	const digits = "0123456789abcdef"
+	if r == 0 {
+		return "0"
+	}
+
+	var buf [8]byte
+	i := len(buf)
+	for ; r > 0; r >>= 4 {
+		i--
+		buf[i] = digits[r&0xf]
+	}
+	return string(buf[i:])
+}
+
+// template returns the output of a class transition as runes, with the
+// placeholder at the byte offset identity if it is not negative.
+func template(out string, identity int) []rune {
+	if identity < 0 {
+		return []rune(out)
+	}
+
+	runes := []rune(out[:identity])
+	runes = append(runes, placeholder)
+	return append(runes, []rune(out[identity:])...)
+}
+
+// fromTemplate converts runes with at most one placeholder back to an output
+// and the byte offset of the placeholder, which is negative if it is absent.
+func fromTemplate(runes []rune) (string, int) {
+	for i, r := range runes {
+		if r == placeholder {
+			before := string(runes[:i])
+			return before + string(runes[i+1:]), len(before)
+		}
+	}
+	return string(runes), -1
+}
+
+// hasPlaceholder reports whether the runes contain the placeholder.
+func hasPlaceholder(runes []rune) bool {
+	for _, r := range runes {
+		if r == placeholder {
+			return true
+		}
+	}
+	return false
+}
+
+// fill returns the output of a class transition on the given symbol.
+func fill(out string, identity int, symbol rune) string {
+	if identity < 0 {
+		return out
+	}
+	return out[:identity] + string(symbol) + out[identity:]
+}
+
+// outputLen returns the length in runes of the output of a class transition.
+func outputLen(out string, identity int) int {
+	n := utf8.RuneCountInString(out)
+	if identity >= 0 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,54 @@
+package relations
+
+import (
+	"testing"
+	"unicode"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCharClassMerges(t *testing.T) {
+	class := newCharClass(runeRange{'x', 'z'}, runeRange{'a', 'c'},
+		runeRange{'d', 'd'}, runeRange{'b', 'f'})
+	assert.Equal(t, charClass{{'a', 'f'}, {'x', 'z'}}, class)
+}
+
+func TestCharClassContains(t *testing.T) {
+	class := newCharClass(runeRange{'a', 'c'}, runeRange{'x', 'z'})
+	assert.True(t, class.contains('a'))
+	assert.True(t, class.contains('y'))
+	assert.False(t, class.contains('d'))
+	assert.False(t, class.contains('`'))
+	assert.False(t, class.contains('{'))
+}
+
+func TestCharClassNegate(t *testing.T) {
+	class := newCharClass(runeRange{'0', '9'})
+	assert.Equal(t, charClass{{1, '/'}, {':', unicode.MaxRune}}, class.negate())
+	assert.Equal(t, class, class.negate().negate())
+	assert.Equal(t, charClass{{1, unicode.MaxRune}}, charClass(nil).negate())
+}
+
+func TestUnicodeClass(t *testing.T) {
+	class := unicodeClass(unicode.Lu)
+	assert.True(t, class.contains('A'))
+	assert.True(t, class.contains('Ж'))
+	assert.False(t, class.contains('a'))
+	assert.False(t, class.contains('ж'))
+}
+
+func TestCharClassString(t *testing.T) {
+	class := newCharClass(runeRange{'a', 'z'}, runeRange{'-', '-'}, runeRange{' ', ' '})
+	assert.Equal(t, `[\u{20}\-a-z]`, class.String())
+}
+
+func TestTemplate(t *testing.T) {
+	runes := template("xy", 1)
+	assert.Equal(t, []rune{'x', placeholder, 'y'}, runes)
+
+	out, identity := fromTemplate(runes)
+	assert.Equal(t, "xy", out)
+	assert.Equal(t, 1, identity)
+	assert.Equal(t, "xay", fill(out, identity, 'a'))
+	assert.Equal(t, "xy", fill(out, -1, 'a'))
+}
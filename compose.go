@@ -0,0 +1,153 @@
+package relations
+
+import (
+	"context"
+
+	"github.com/oleiade/lane"
+)
+
+// Compose builds a RegularRelation whose output for a given input equals the
+// output of b for the output of a for that input. Every result of a is fed
+// into b, so several final outputs of either relation are combined.
+// An error is returned if the composition is not subsequential.
+func Compose(a, b *RegularRelation) (*RegularRelation, error) {
+	// Pairs of states of a and b with the corresponding transducer state.
+	type product struct {
+		a, b *sState
+	}
+	states := map[product]*tState{}
+	unmarked := lane.NewQueue()
+	tr := &transducer{}
+
+	addState := func(p product) *tState {
+		if state, ok := states[p]; ok {
+			return state
+		}
+
+		state := &tState{
+			index: len(tr.states) + 1,
+			next:  map[rune][]*tTransition{},
+		}
+		states[p] = state
+		tr.states = append(tr.states, state)
+		unmarked.Enqueue(p)
+
+		return state
+	}
+
+	// Feed the prefix of a into b.
+	bStart, prefix, ok := b.start.walk(a.prefix)
+	if !ok {
+		// Nothing produced by a is accepted by b.
+		return &RegularRelation{start: newSState()}, nil
+	}
+	tr.prefix = b.prefix + prefix
+	tr.root = addState(product{a.start, bStart})
+
+	for unmarked.Size() != 0 {
+		p := unmarked.Dequeue().(product)
+		state := states[p]
+
+		for symbol, aNext := range p.a.next {
+			bNext, out, ok := p.b.walk(p.a.out[symbol])
+			if !ok {
+				continue
+			}
+
+			state.next[symbol] = []*tTransition{{
+				state: addState(product{aNext, bNext}),
+				out:   out,
+			}}
+		}
+
+		for _, r := range p.a.ranges {
+			if r.identity < 0 {
+				bNext, out, ok := p.b.walk(r.out)
+				if !ok {
+					continue
+				}
+
+				state.classes = append(state.classes, &tClassTransition{
+					class:    charClass{{r.lo, r.hi}},
+					state:    addState(product{r.next, bNext}),
+					out:      out,
+					identity: -1,
+				})
+				continue
+			}
+
+			// The symbol read is fed into b between the rest of the
+			// output, so the transitions of b on it split the range.
+			bMid, before, ok := p.b.walk(r.out[:r.identity])
+			if !ok {
+				continue
+			}
+			after := r.out[r.identity:]
+
+			for _, symbol := range bMid.symbols() {
+				if symbol < r.lo || symbol > r.hi {
+					continue
+				}
+				bNext, out, ok := bMid.next[symbol].walk(after)
+				if !ok {
+					continue
+				}
+
+				state.next[symbol] = []*tTransition{{
+					state: addState(product{r.next, bNext}),
+					out:   before + bMid.out[symbol] + out,
+				}}
+			}
+
+			for _, bRange := range bMid.ranges {
+				lo, hi := r.lo, r.hi
+				if bRange.lo > lo {
+					lo = bRange.lo
+				}
+				if bRange.hi < hi {
+					hi = bRange.hi
+				}
+				if lo > hi {
+					continue
+				}
+
+				bNext, out, ok := bRange.next.walk(after)
+				if !ok {
+					continue
+				}
+
+				identity := -1
+				if bRange.identity >= 0 {
+					identity = len(before) + bRange.identity
+				}
+				state.classes = append(state.classes, &tClassTransition{
+					class:    charClass{{lo, hi}},
+					state:    addState(product{r.next, bNext}),
+					out:      before + bRange.out + out,
+					identity: identity,
+				})
+			}
+		}
+
+		if !p.a.final {
+			continue
+		}
+
+		// Complete each final output of a in b.
+		for _, aOut := range p.a.finalOut {
+			bFinal, out, ok := p.b.walk(aOut)
+			if !ok || !bFinal.final {
+				continue
+			}
+
+			state.final = true
+			for _, bOut := range bFinal.finalOut {
+				state.finalOut = append(state.finalOut, out+bOut)
+			}
+		}
+	}
+
+	tr.trim()
+
+	return subsequentialize(context.Background(), tr, BuildOptions{})
+}
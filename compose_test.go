@@ -0,0 +1,91 @@
+package relations
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildRelation(t *testing.T, regexp string) *RegularRelation {
+	rr, err := Build(strings.NewReader(regexp))
+	assert.Nil(t, err)
+	return rr
+}
+
+func TestCompose(t *testing.T) {
+	lower := buildRelation(t, `(<A,a>+<a,a>+<B,b>+<b,b>+<C,c>+<c,c>)*`)
+	translit := buildRelation(t, `(<a,α>+<b,β>+<c,ξ>)*`)
+
+	rr, err := Compose(lower, translit)
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("AbCa")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"αβξα"}, out)
+}
+
+func TestComposeChain(t *testing.T) {
+	first := buildRelation(t, `<ab,xyz>+<ac,xy>`)
+	second := buildRelation(t, `<x,>.((<y,1>.<z,2>)+<y,3>)`)
+	third := buildRelation(t, `<12,twelve>+<3,three>`)
+
+	rr, err := Compose(first, second)
+	assert.Nil(t, err)
+	rr, err = Compose(rr, third)
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("ab")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"twelve"}, out)
+
+	out, ok = rr.Transduce("ac")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"three"}, out)
+}
+
+func TestComposeSeveralOutputs(t *testing.T) {
+	first := buildRelation(t, `<a,x>+<a,xy>+<a,xz>`)
+	second := buildRelation(t, `<x,1>.(<y,2>+<,>)`)
+
+	rr, err := Compose(first, second)
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("a")
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []string{"1", "12"}, out)
+}
+
+func TestComposeMinimizedPrefix(t *testing.T) {
+	first := buildRelation(t, `<a,xy>+<b,xz>`)
+	first.Minimize()
+	second := buildRelation(t, `<xy,1>+<xz,2>`)
+	second.Minimize()
+
+	rr, err := Compose(first, second)
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("b")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"2"}, out)
+}
+
+func TestComposeEmpty(t *testing.T) {
+	rr, err := Compose(buildRelation(t, `<a,x>`), buildRelation(t, `<y,z>`))
+	assert.Nil(t, err)
+
+	_, ok := rr.Transduce("a")
+	assert.False(t, ok)
+}
+
+func TestComposeClasses(t *testing.T) {
+	upper := buildRelation(t, `([a-z]+<[A-Z],_>)*`)
+	dashes := buildRelation(t, `(<_,->+[a-z])*`)
+
+	rr, err := Compose(upper, dashes)
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("aBcD")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a-c-"}, out)
+}
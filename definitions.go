@@ -0,0 +1,170 @@
+package relations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oleiade/lane"
+)
+
+// definition is a named expression kept as its tokens, which are parsed anew
+// wherever it is referenced so that each reference has its own positions.
+// The tokens end with an eof token in place of the closing `;`.
+type definition struct {
+	name   token
+	tokens []token
+}
+
+// CycleError reports a definition that refers to itself, directly or through
+// other definitions.
+type CycleError struct {
+	Offset int      // byte offset of the reference closing the cycle
+	Line   int      // line of the reference, starting from 1
+	Column int      // column of the reference, starting from 1
+	Names  []string // definitions on the cycle, the first one repeated last
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("recursive definition at %d:%d: %s",
+		e.Line, e.Column, strings.Join(e.Names, " -> "))
+}
+
+// definition consumes the definition of the identifier token name up to the
+// closing `;`.
+func (p *parser) definition(name token) error {
+	if _, ok := p.definitions[name.name]; ok {
+		return newSyntaxError(name,
+			fmt.Sprintf("expected a new name, %s is already defined", name.name))
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.kind != define {
+		return newSyntaxError(t, fmt.Sprintf("expected '=' after %s", name.name))
+	}
+
+	def := &definition{name: name}
+	for {
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+
+		switch t.kind {
+		case terminator:
+			def.tokens = append(def.tokens, token{kind: eof, text: t.text, pos: t.pos})
+			p.definitions[name.name] = def
+			p.order = append(p.order, def)
+			return nil
+		case eof, identifier, define:
+			return newSyntaxError(t, "expected ';' to end the definition")
+		}
+
+		def.tokens = append(def.tokens, t)
+	}
+}
+
+// checkDefinitions reports references to missing definitions and cycles
+// among the definitions, then parses each definition on its own so that
+// even unused ones have to be valid expressions.
+func (p *parser) checkDefinitions() error {
+	done := map[string]bool{}
+	var path []string // definitions being visited
+
+	var visit func(def *definition) error
+	visit = func(def *definition) error {
+		path = append(path, def.name.name)
+
+		for _, t := range def.tokens {
+			if t.kind != reference {
+				continue
+			}
+
+			ref, ok := p.definitions[t.name]
+			if !ok {
+				return newSyntaxError(t, "expected the name of a definition")
+			}
+			for i, name := range path {
+				if name == t.name {
+					return &CycleError{
+						Offset: t.pos.offset,
+						Line:   t.pos.line,
+						Column: t.pos.column,
+						Names:  append(append([]string(nil), path[i:]...), t.name),
+					}
+				}
+			}
+
+			if !done[t.name] {
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		done[def.name.name] = true
+		return nil
+	}
+
+	for _, def := range p.order {
+		if done[def.name.name] {
+			continue
+		}
+		if err := visit(def); err != nil {
+			return err
+		}
+	}
+
+	for _, def := range p.order {
+		check := &parser{
+			exprs:       lane.NewStack(),
+			operators:   lane.NewStack(),
+			queue:       def.tokens,
+			definitions: p.definitions,
+			checking:    true,
+		}
+		if err := check.expression(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// maxExpansion is the largest number of tokens that the references of an
+// expression may expand to. Definitions that refer to each other twice can
+// double the size of the expression with every level, so without a limit a
+// few lines could exhaust the memory.
+const maxExpansion = 1 << 16
+
+// expand replaces the reference token t by the tokens of the definition it
+// refers to, enclosed in parentheses. While checking a definition the
+// reference is parsed as an empty pair instead.
+func (p *parser) expand(t token) error {
+	def, ok := p.definitions[t.name]
+	if !ok {
+		return newSyntaxError(t, "expected the name of a definition")
+	}
+
+	if p.checking {
+		p.exprs.Push(&Expr{kind: PairExpr, pos: t.pos})
+		return nil
+	}
+
+	p.expanded += len(def.tokens) + 1
+	if p.expanded > maxExpansion {
+		return newSyntaxError(t, fmt.Sprintf(
+			"expected the references to expand to at most %d tokens", maxExpansion))
+	}
+
+	tokens := make([]token, 0, len(def.tokens)+1+len(p.queue))
+	tokens = append(tokens, token{kind: '(', text: t.text, pos: t.pos})
+	tokens = append(tokens, def.tokens[:len(def.tokens)-1]...)
+	tokens = append(tokens, token{kind: ')', text: t.text, pos: t.pos})
+	p.queue = append(tokens, p.queue...)
+
+	return nil
+}
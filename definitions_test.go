@@ -0,0 +1,138 @@
+package relations
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefinitions(t *testing.T) {
+	rr, err := Build(strings.NewReader(
+		`Vowel=<a,A>+<e,E>;Stem=<k,k>{Vowel}<t,t>;{Stem}<s,s>?+{Vowel}`))
+	assert.Nil(t, err)
+
+	for input, expected := range map[string]string{
+		"kat":  "kAt",
+		"kets": "kEts",
+		"e":    "E",
+	} {
+		out, ok := rr.Transduce(input)
+		assert.True(t, ok, input)
+		assert.Equal(t, []string{expected}, out, input)
+	}
+
+	_, ok := rr.Transduce("kt")
+	assert.False(t, ok)
+}
+
+func TestForwardReference(t *testing.T) {
+	rr, err := Build(strings.NewReader(`Word={Letter}^;Letter=[a-z];{Word}<.,>`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("abc.")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"abc"}, out)
+}
+
+func TestReferencesHaveFreshPositions(t *testing.T) {
+	testParserMetadata(`A=<a,x>;{A}{A}`, func(meta *parserMeta) {
+		var positions []int
+		for position, rule := range meta.rules {
+			if rule.in == 'a' && meta.follow[position] != nil {
+				positions = append(positions, position)
+			}
+		}
+		assert.Len(t, positions, 2)
+	})
+}
+
+func TestRecursiveDefinition(t *testing.T) {
+	_, err := Build(strings.NewReader(`A=<a,a>{B};B=<b,b>+{C};C={A};<x,y>`))
+
+	var cycle *CycleError
+	if assert.True(t, errors.As(err, &cycle)) {
+		assert.Equal(t, []string{"A", "B", "C", "A"}, cycle.Names)
+		assert.Equal(t, 26, cycle.Column)
+		assert.EqualError(t, err, "recursive definition at 1:26: A -> B -> C -> A")
+	}
+
+	_, err = Build(strings.NewReader(`A=<a,a>{A}?;<x,y>`))
+	assert.True(t, errors.As(err, &cycle))
+	assert.Equal(t, []string{"A", "A"}, cycle.Names)
+}
+
+func TestDefinitionExpansionLimit(t *testing.T) {
+	// Each definition refers to the previous one twice.
+	chain := func(n int) string {
+		source := "D0=<x,x><x,x>;"
+		for i := 1; i < n; i++ {
+			source += fmt.Sprintf("D%d={D%d}{D%d};", i, i-1, i-1)
+		}
+		return source + fmt.Sprintf("{D%d}", n-1)
+	}
+
+	_, err := Parse(strings.NewReader(chain(10)))
+	assert.Nil(t, err)
+
+	_, err = Parse(strings.NewReader(chain(40)))
+	var syntaxErr *SyntaxError
+	if assert.True(t, errors.As(err, &syntaxErr)) {
+		assert.Equal(t, "expected the references to expand to at most 65536 tokens",
+			syntaxErr.Expected)
+	}
+}
+
+func TestDefinitionErrors(t *testing.T) {
+	testSyntaxError(t, `A=<a,b>;A=<c,d>;{A}`, &SyntaxError{
+		Offset: 8, Line: 1, Column: 9, Token: "A",
+		Expected: "expected a new name, A is already defined",
+	})
+	testSyntaxError(t, `A<a,b>;{A}`, &SyntaxError{
+		Offset: 1, Line: 1, Column: 2, Token: "<a,b>",
+		Expected: "expected '=' after A",
+	})
+	testSyntaxError(t, `A=<a,b>`, &SyntaxError{
+		Offset: 7, Line: 1, Column: 8,
+		Expected: "expected ';' to end the definition",
+	})
+	testSyntaxError(t, `A=<a,b>+;<c,d>`, &SyntaxError{
+		Offset: 8, Line: 1, Column: 9, Token: ";",
+		Expected: "expected operand after '+'",
+	})
+	testSyntaxError(t, `A=<a,b>;{B}`, &SyntaxError{
+		Offset: 8, Line: 1, Column: 9, Token: "{B}",
+		Expected: "expected the name of a definition",
+	})
+	testSyntaxError(t, `A=<a,b>;`, &SyntaxError{
+		Offset: 8, Line: 1, Column: 9,
+		Expected: "expected expression",
+	})
+	testSyntaxError(t, `<a,b>;`, &SyntaxError{
+		Offset: 5, Line: 1, Column: 6, Token: ";",
+		Expected: "expected operator",
+	})
+	testSyntaxError(t, `{A`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: "{A",
+		Expected: "expected '}' to close the reference",
+	})
+}
+
+func TestDefinitionFile(t *testing.T) {
+	rr, err := Build(strings.NewReader(`
+# Vowels are capitalized.
+Vowel = <a,A> + <e,E>;
+
+# Consonants stay as they are.
+Consonant = [b-df-hj-np-tv-z];
+
+({Consonant} + {Vowel})*   # main expression
+`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("beta")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"bEtA"}, out)
+}
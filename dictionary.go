@@ -0,0 +1,209 @@
+package relations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors reported by FromPairs for input that is not a valid dictionary.
+var (
+	ErrUnsortedInput  = errors.New("inputs are not sorted")
+	ErrDuplicateInput = errors.New("input has more than one output")
+)
+
+// DictionaryOptions controls how FromPairs treats repeated inputs.
+type DictionaryOptions struct {
+	// RejectDuplicates makes FromPairs fail with ErrDuplicateInput when an
+	// input is paired with different outputs, instead of keeping all of
+	// them as alternatives.
+	RejectDuplicates bool
+}
+
+// dictionary incrementally builds a minimal subsequential transducer from
+// pairs sorted by input, as described by Mihov and Maurel in _Direct
+// Construction of Minimal Acyclic Subsequential Transducers_. The states on
+// the path of the last input are still open for changes, all other states
+// are minimal and kept in the register.
+type dictionary struct {
+	register map[string]*sState
+	ids      map[*sState]int
+	path     []*sState // path[i] is reached with the first i runes of last
+	last     []rune
+	lastIn   string
+	lastOut  string
+	started  bool
+	opts     DictionaryOptions
+}
+
+func newDictionary(opts DictionaryOptions) *dictionary {
+	return &dictionary{
+		register: map[string]*sState{},
+		ids:      map[*sState]int{},
+		path:     []*sState{newSState()},
+		opts:     opts,
+	}
+}
+
+// signature describes the finality, final outputs and transitions of a
+// state whose targets are all in the register.
+func (d *dictionary) signature(state *sState) string {
+	var b strings.Builder
+	b.WriteString(strconv.FormatBool(state.final))
+	for _, o := range state.finalOut {
+		b.WriteString(" " + strconv.Quote(o))
+	}
+	b.WriteString(" |")
+	for _, symbol := range state.symbols() {
+		b.WriteString(" " + strconv.QuoteRune(symbol))
+		b.WriteString(":" + strconv.Quote(state.out[symbol]))
+		b.WriteString(">" + strconv.Itoa(d.ids[state.next[symbol]]))
+	}
+	return b.String()
+}
+
+// freeze replaces the states of the path after the first n+1 by equivalent
+// states of the register, registering those that have none, and removes
+// them from the path.
+func (d *dictionary) freeze(n int) {
+	for i := len(d.path) - 1; i > n; i-- {
+		state := d.path[i]
+		state.finalOut = finalOutSet(state.finalOut)
+
+		signature := d.signature(state)
+		if equal, ok := d.register[signature]; ok {
+			d.path[i-1].next[d.last[i-1]] = equal
+		} else {
+			d.register[signature] = state
+			d.ids[state] = len(d.ids)
+		}
+	}
+	d.path = d.path[:n+1]
+}
+
+// add adds the pair of in and out, where in must not precede the input of
+// the previously added pair.
+func (d *dictionary) add(in, out string) error {
+	input := []rune(in)
+	if d.started && in < d.lastIn {
+		return fmt.Errorf("%w: %q after %q", ErrUnsortedInput, in, d.lastIn)
+	}
+
+	n := 0
+	for n < len(input) && n < len(d.last) && input[n] == d.last[n] {
+		n++
+	}
+	duplicate := d.started && n == len(input) && n == len(d.last)
+	if duplicate && d.opts.RejectDuplicates && out != d.lastOut {
+		return fmt.Errorf("%w: %q has outputs %q and %q",
+			ErrDuplicateInput, in, d.lastOut, out)
+	}
+
+	d.freeze(n)
+	d.last, d.lastIn, d.lastOut = input, in, out
+	d.started = true
+
+	for _, symbol := range input[n:] {
+		next := newSState()
+		state := d.path[len(d.path)-1]
+		state.next[symbol] = next
+		state.out[symbol] = ""
+		d.path = append(d.path, next)
+	}
+
+	// Keep the common prefix of the outputs on the shared path and move
+	// the rest of the earlier outputs one state further.
+	for i, symbol := range input[:n] {
+		state, next := d.path[i], d.path[i+1]
+		common := commonPrefixString(state.out[symbol], out)
+		suffix := state.out[symbol][len(common):]
+		state.out[symbol] = common
+		out = out[len(common):]
+
+		if suffix == "" {
+			continue
+		}
+		for s := range next.out {
+			next.out[s] = suffix + next.out[s]
+		}
+		for j := range next.finalOut {
+			next.finalOut[j] = suffix + next.finalOut[j]
+		}
+	}
+
+	end := d.path[len(input)]
+	if n < len(input) {
+		d.path[n].out[input[n]] = out
+		out = ""
+	}
+	end.final = true
+	end.finalOut = append(end.finalOut, out)
+	return nil
+}
+
+// relation freezes the remaining states and returns the transducer.
+func (d *dictionary) relation() *RegularRelation {
+	d.freeze(0)
+	start := d.path[0]
+	start.finalOut = finalOutSet(start.finalOut)
+	return &RegularRelation{start: start}
+}
+
+// commonPrefixString returns the longest common prefix of a and b that ends
+// on a rune boundary.
+func commonPrefixString(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) {
+		r, size := utf8.DecodeRuneInString(a[i:])
+		if s, _ := utf8.DecodeRuneInString(b[i:]); r != s {
+			break
+		}
+		i += size
+	}
+	return a[:i]
+}
+
+// FromPairs builds the minimal RegularRelation of a finite dictionary from
+// pairs of input and output, which must be sorted by input. Unlike Build it
+// constructs the transducer directly, one pair at a time, which is much
+// faster for large word lists. An input paired with several outputs is
+// transduced to all of them unless opts.RejectDuplicates is set.
+//
+// The pairs are yielded by a sequence function, so an iter.Seq2[string,
+// string] can be passed directly.
+func FromPairs(pairs func(yield func(in, out string) bool),
+	opts DictionaryOptions) (*RegularRelation, error) {
+
+	d := newDictionary(opts)
+	var err error
+	pairs(func(in, out string) bool {
+		err = d.add(in, out)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.relation(), nil
+}
+
+// FromMap builds the minimal RegularRelation that transduces each key of m
+// to its value.
+func FromMap(m map[string]string) (*RegularRelation, error) {
+	inputs := make([]string, 0, len(m))
+	for in := range m {
+		inputs = append(inputs, in)
+	}
+	sort.Strings(inputs)
+
+	return FromPairs(func(yield func(in, out string) bool) {
+		for _, in := range inputs {
+			if !yield(in, m[in]) {
+				return
+			}
+		}
+	}, DictionaryOptions{})
+}
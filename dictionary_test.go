@@ -0,0 +1,164 @@
+package relations
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pairsOf yields the given inputs and outputs in turn.
+func pairsOf(pairs ...string) func(yield func(in, out string) bool) {
+	return func(yield func(in, out string) bool) {
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if !yield(pairs[i], pairs[i+1]) {
+				return
+			}
+		}
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	m := map[string]string{
+		"walk": "walked", "talk": "talked", "jump": "jumped", "bump": "bumped",
+	}
+	rr, err := FromMap(m)
+	assert.Nil(t, err)
+
+	states, transitions := rr.Size()
+	assert.Equal(t, 8, states)
+	assert.Equal(t, 10, transitions)
+
+	for in, out := range m {
+		result, ok := rr.Transduce(in)
+		assert.True(t, ok)
+		assert.Equal(t, []string{out}, result)
+	}
+
+	_, ok := rr.Transduce("wump")
+	assert.False(t, ok)
+	_, ok = rr.Transduce("wal")
+	assert.False(t, ok)
+}
+
+func TestFromPairsMatchesMinimize(t *testing.T) {
+	words := []string{"", "a", "ab", "abc", "abd", "b", "bc", "bcd", "ж", "жж"}
+	outputs := []string{"e", "x", "xy", "xyz", "xyw", "y", "x", "xy", "я", "яя"}
+
+	var union []string
+	var pairs []string
+	for i, word := range words {
+		union = append(union, "<"+word+","+outputs[i]+">")
+		pairs = append(pairs, word, outputs[i])
+	}
+	minimal, err := Build(strings.NewReader(strings.Join(union, "+")))
+	assert.Nil(t, err)
+	minimal.Minimize()
+
+	rr, err := FromPairs(pairsOf(pairs...), DictionaryOptions{})
+	assert.Nil(t, err)
+
+	states, transitions := minimal.Size()
+	s, tr := rr.Size()
+	assert.Equal(t, states, s)
+	assert.Equal(t, transitions, tr)
+
+	for i, word := range words {
+		result, ok := rr.Transduce(word)
+		assert.True(t, ok)
+		assert.Equal(t, []string{outputs[i]}, result)
+	}
+}
+
+func TestFromPairsDuplicates(t *testing.T) {
+	pairs := pairsOf("go", "went", "go", "gone", "go", "went", "got", "get")
+
+	rr, err := FromPairs(pairs, DictionaryOptions{})
+	assert.Nil(t, err)
+	result, ok := rr.Transduce("go")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"gone", "went"}, result)
+	result, ok = rr.Transduce("got")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"get"}, result)
+
+	_, err = FromPairs(pairs, DictionaryOptions{RejectDuplicates: true})
+	assert.True(t, errors.Is(err, ErrDuplicateInput))
+	assert.Contains(t, err.Error(), `"go" has outputs "went" and "gone"`)
+
+	_, err = FromPairs(pairsOf("go", "went", "go", "went"),
+		DictionaryOptions{RejectDuplicates: true})
+	assert.Nil(t, err)
+}
+
+func TestFromPairsUnsorted(t *testing.T) {
+	_, err := FromPairs(pairsOf("b", "x", "ab", "y"), DictionaryOptions{})
+	assert.True(t, errors.Is(err, ErrUnsortedInput))
+	assert.Contains(t, err.Error(), `"ab" after "b"`)
+
+	_, err = FromPairs(pairsOf("a", "x", "b", "y", "a", "z"), DictionaryOptions{})
+	assert.True(t, errors.Is(err, ErrUnsortedInput))
+}
+
+func TestFromPairsEmpty(t *testing.T) {
+	rr, err := FromMap(nil)
+	assert.Nil(t, err)
+	_, ok := rr.Transduce("")
+	assert.False(t, ok)
+
+	states, transitions := rr.Size()
+	assert.Equal(t, 1, states)
+	assert.Equal(t, 0, transitions)
+}
+
+func TestFromPairsStopsEarly(t *testing.T) {
+	yielded := 0
+	pairs := func(yield func(in, out string) bool) {
+		for _, in := range []string{"b", "a", "c"} {
+			yielded++
+			if !yield(in, in) {
+				return
+			}
+		}
+	}
+
+	_, err := FromPairs(pairs, DictionaryOptions{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, yielded)
+}
+
+func TestFromPairsLarge(t *testing.T) {
+	m := map[string]string{}
+	var b strings.Builder
+	for i := 0; i < 2000; i++ {
+		b.Reset()
+		for n := i; ; n /= 7 {
+			b.WriteByte(byte('a' + n%7))
+			if n < 7 {
+				break
+			}
+		}
+		m[b.String()] = strings.ToUpper(b.String())
+	}
+
+	rr, err := FromMap(m)
+	assert.Nil(t, err)
+
+	inputs := make([]string, 0, len(m))
+	for in := range m {
+		inputs = append(inputs, in)
+	}
+	sort.Strings(inputs)
+	for _, in := range inputs {
+		result, ok := rr.Transduce(in)
+		assert.True(t, ok)
+		assert.Equal(t, []string{m[in]}, result)
+	}
+
+	states, _ := rr.Size()
+	rr.Minimize()
+	minimal, _ := rr.Size()
+	assert.Equal(t, minimal, states)
+}
@@ -0,0 +1,182 @@
+package relations
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DOTOptions controls the Graphviz output of WriteDOT.
+type DOTOptions struct {
+	// ShowPairs adds to each state the pairs of transducer state and
+	// delayed output it was constructed from. Only transducers fresh from
+	// Build have them.
+	ShowPairs bool
+}
+
+// dotEscaper escapes the characters that are special in DOT strings.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotSymbol returns the label of an input or output string, showing the
+// empty one as ε.
+func dotSymbol(s string) string {
+	if s == "" || s == string(rune(epsilon)) {
+		return "ε"
+	}
+	return dotEscaper.Replace(s)
+}
+
+// dotClassOutput returns the label of the output of a transition on a
+// character class, showing the symbol read as @.
+func dotClassOutput(out string, identity int) string {
+	if identity < 0 {
+		return dotSymbol(out)
+	}
+	return dotEscaper.Replace(out[:identity]) + "@" + dotEscaper.Replace(out[identity:])
+}
+
+// dotFinalOut returns the label of the final outputs of a state.
+func dotFinalOut(finalOut []string) string {
+	labels := make([]string, len(finalOut))
+	for i, o := range finalOut {
+		labels[i] = dotSymbol(o)
+	}
+	return "[" + strings.Join(labels, ", ") + "]"
+}
+
+// WriteDOT writes the transducer to w in the Graphviz DOT language. Edges
+// are labelled with their input and output, final states are drawn with a
+// double circle and list their final outputs. Edges on ranges of symbols
+// show the symbol read in their output as @.
+func (s *RegularRelation) WriteDOT(w io.Writer, opts DOTOptions) error {
+	b := bufio.NewWriter(w)
+
+	states := s.states()
+	index := map[*sState]int{}
+	for i, state := range states {
+		index[state] = i
+	}
+
+	fmt.Fprintln(b, "digraph relation {")
+	fmt.Fprintln(b, "\trankdir=LR;")
+	fmt.Fprintln(b, "\tnode [shape=circle];")
+	fmt.Fprintln(b, "\tstart [shape=point];")
+	if s.prefix != "" {
+		fmt.Fprintf(b, "\tstart -> 0 [label=\":%s\"];\n", dotSymbol(s.prefix))
+	} else {
+		fmt.Fprintln(b, "\tstart -> 0;")
+	}
+
+	for i, state := range states {
+		label := fmt.Sprint(i)
+		if state.final {
+			label += `\n` + dotFinalOut(state.finalOut)
+		}
+		if opts.ShowPairs {
+			for _, p := range state.remainingPairs {
+				p := p.(*pair)
+				label += fmt.Sprintf(`\n(%d, %s)`, p.state.index, dotSymbol(p.remaining))
+			}
+		}
+
+		shape := "circle"
+		if state.final {
+			shape = "doublecircle"
+		}
+		fmt.Fprintf(b, "\t%d [shape=%s, label=\"%s\"];\n", i, shape, label)
+
+		for _, symbol := range state.symbols() {
+			fmt.Fprintf(b, "\t%d -> %d [label=\"%s:%s\"];\n",
+				i, index[state.next[symbol]],
+				dotSymbol(string(symbol)), dotSymbol(state.out[symbol]))
+		}
+		for _, r := range state.ranges {
+			fmt.Fprintf(b, "\t%d -> %d [label=\"%s:%s\"];\n",
+				i, index[r.next], dotEscaper.Replace(charClass{{r.lo, r.hi}}.String()),
+				dotClassOutput(r.out, r.identity))
+		}
+	}
+
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// writeDOT writes the transducer to w in the Graphviz DOT language. States
+// are named after their index.
+func (t *transducer) writeDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintln(b, "digraph transducer {")
+	fmt.Fprintln(b, "\trankdir=LR;")
+	fmt.Fprintln(b, "\tnode [shape=circle];")
+	fmt.Fprintln(b, "\tstart [shape=point];")
+	if t.prefix != "" {
+		fmt.Fprintf(b, "\tstart -> %d [label=\":%s\"];\n",
+			t.root.index, dotSymbol(t.prefix))
+	} else {
+		fmt.Fprintf(b, "\tstart -> %d;\n", t.root.index)
+	}
+
+	for _, state := range t.states {
+		if state.final {
+			label := fmt.Sprint(state.index)
+			if len(state.finalOut) != 0 {
+				label += `\n` + dotFinalOut(state.finalOut)
+			}
+			fmt.Fprintf(b, "\t%d [shape=doublecircle, label=\"%s\"];\n",
+				state.index, label)
+		} else {
+			fmt.Fprintf(b, "\t%d;\n", state.index)
+		}
+
+		symbols := make([]rune, 0, len(state.next))
+		for symbol := range state.next {
+			symbols = append(symbols, symbol)
+		}
+		sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+
+		for _, symbol := range symbols {
+			transitions := append([]*tTransition(nil), state.next[symbol]...)
+			sort.Slice(transitions, func(i, j int) bool {
+				if transitions[i].state.index == transitions[j].state.index {
+					return transitions[i].out < transitions[j].out
+				}
+				return transitions[i].state.index < transitions[j].state.index
+			})
+
+			for _, tr := range transitions {
+				fmt.Fprintf(b, "\t%d -> %d [label=\"%s:%s\"];\n",
+					state.index, tr.state.index,
+					dotSymbol(string(symbol)), dotSymbol(tr.out))
+			}
+		}
+
+		labels := make([]string, len(state.classes))
+		for i, c := range state.classes {
+			labels[i] = fmt.Sprintf("\t%d -> %d [label=\"%s:%s\"];\n",
+				state.index, c.state.index, dotEscaper.Replace(c.class.String()),
+				dotClassOutput(c.out, c.identity))
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			b.WriteString(label)
+		}
+	}
+
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// WriteTransducerDOT writes the non-deterministic transducer constructed from
+// the regular relation expression, before it is made subsequential, to w in
+// the Graphviz DOT language.
+func WriteTransducerDOT(source io.Reader, w io.Writer) error {
+	tr, err := newTransducer(source)
+	if err != nil {
+		return err
+	}
+
+	return tr.writeDOT(w)
+}
@@ -0,0 +1,65 @@
+package relations
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDOT(t *testing.T) {
+	rr := buildRelation(t, `<ab,x>+<ac,\"y>`)
+
+	var b bytes.Buffer
+	assert.Nil(t, rr.WriteDOT(&b, DOTOptions{}))
+	assert.Equal(t, `digraph relation {
+	rankdir=LR;
+	node [shape=circle];
+	start [shape=point];
+	start -> 0;
+	0 [shape=circle, label="0"];
+	0 -> 1 [label="a:ε"];
+	1 [shape=circle, label="1"];
+	1 -> 2 [label="b:x"];
+	1 -> 2 [label="c:\"y"];
+	2 [shape=doublecircle, label="2\n[ε]"];
+}
+`, b.String())
+}
+
+func TestWriteDOTWithPairs(t *testing.T) {
+	rr := buildRelation(t, `<a,x>+<a,y>`)
+
+	var b bytes.Buffer
+	assert.Nil(t, rr.WriteDOT(&b, DOTOptions{ShowPairs: true}))
+	assert.Contains(t, b.String(), `0 [shape=circle, label="0\n(1, ε)"];`)
+	assert.Contains(t, b.String(),
+		`1 [shape=doublecircle, label="1\n[x, y]\n(2, x)\n(2, y)"];`)
+}
+
+func TestWriteTransducerDOT(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteTransducerDOT(strings.NewReader(`<a,x>+<a,y>`), &b)
+	assert.Nil(t, err)
+	assert.Equal(t, `digraph transducer {
+	rankdir=LR;
+	node [shape=circle];
+	start [shape=point];
+	start -> 1;
+	1;
+	1 -> 2 [label="a:x"];
+	1 -> 2 [label="a:y"];
+	2 [shape=doublecircle, label="2"];
+}
+`, b.String())
+}
+
+func TestWriteDOTRanges(t *testing.T) {
+	rr := buildRelation(t, `[a-c]<d,x>`)
+	rr.Minimize()
+
+	var b bytes.Buffer
+	assert.Nil(t, rr.WriteDOT(&b, DOTOptions{}))
+	assert.Contains(t, b.String(), `0 -> 1 [label="[a-c]:@x"];`)
+}
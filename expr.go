@@ -0,0 +1,271 @@
+package relations
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ExprKind is the kind of a node of an expression tree.
+type ExprKind int
+
+// Kinds of expressions.
+const (
+	PairExpr      ExprKind = iota // <in,out> pair
+	ClassExpr                     // character class
+	UnionExpr                     // a+b
+	ConcatExpr                    // a.b
+	StarExpr                      // a*
+	OptionalExpr                  // a?
+	OneOrMoreExpr                 // a^
+	RepeatExpr                    // a{min,max}
+)
+
+var exprKindNames = map[ExprKind]string{
+	PairExpr:      "pair",
+	ClassExpr:     "class",
+	UnionExpr:     "union",
+	ConcatExpr:    "concatenation",
+	StarExpr:      "star",
+	OptionalExpr:  "optional",
+	OneOrMoreExpr: "one or more",
+	RepeatExpr:    "repetition",
+}
+
+func (k ExprKind) String() string {
+	if name, ok := exprKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ExprKind(%d)", int(k))
+}
+
+// Operators of the kinds of expressions that have operands.
+var exprOperators = map[ExprKind]rune{
+	UnionExpr:     union,
+	ConcatExpr:    concat,
+	StarExpr:      repeat,
+	OptionalExpr:  optional,
+	OneOrMoreExpr: oneOrMore,
+	RepeatExpr:    repetition,
+}
+
+// Position is a location in the source of an expression.
+type Position struct {
+	Offset int // byte offset, starting from 0
+	Line   int // line number, starting from 1
+	Column int // column in runes, starting from 1
+}
+
+// Expr is a node of the tree of a parsed regular relation expression. It is
+// immutable, so subexpressions can be shared between trees.
+type Expr struct {
+	kind     ExprKind
+	in       string
+	out      string
+	class    charClass
+	identity bool
+	min      int
+	max      int
+	operands []*Expr
+	pos      position
+}
+
+// Parse parses the regular relation expression read from source, together
+// with the definitions preceding it, without building a transducer.
+// References to definitions are replaced by the expressions they stand for.
+func Parse(source io.Reader) (*Expr, error) {
+	p := newParser(source)
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.exprs.Pop().(*Expr), nil
+}
+
+// Kind returns the kind of the expression.
+func (e *Expr) Kind() ExprKind {
+	return e.kind
+}
+
+// Pos returns the position in the source where the expression starts. It is
+// the zero Position for expressions that were not parsed.
+func (e *Expr) Pos() Position {
+	return Position{Offset: e.pos.offset, Line: e.pos.line, Column: e.pos.column}
+}
+
+// Input returns the input of a pair, or the character class of a class in
+// bracket syntax.
+func (e *Expr) Input() string {
+	if e.kind == ClassExpr {
+		return e.class.String()
+	}
+	return e.in
+}
+
+// Output returns the output of a pair or a class.
+func (e *Expr) Output() string {
+	return e.out
+}
+
+// Identity reports whether a class maps each symbol to itself instead of to
+// the output.
+func (e *Expr) Identity() bool {
+	return e.identity
+}
+
+// Min returns the minimum number of repetitions of a repetition.
+func (e *Expr) Min() int {
+	return e.min
+}
+
+// Max returns the maximum number of repetitions of a repetition, which is
+// negative if there is no bound.
+func (e *Expr) Max() int {
+	return e.max
+}
+
+// Operands returns the operands of an operator, the left one first.
+func (e *Expr) Operands() []*Expr {
+	return append([]*Expr(nil), e.operands...)
+}
+
+// Invert returns the expression with the input and output of every pair
+// swapped. A class with constant output becomes the union of the pairs of
+// the output with each symbol of the class, which is reported with
+// ErrWideClass for classes of more than 4096 symbols.
+func (e *Expr) Invert() (*Expr, error) {
+	inverse := *e
+	switch e.kind {
+	case PairExpr:
+		inverse.in, inverse.out = e.out, e.in
+
+	case ClassExpr:
+		if e.identity {
+			break
+		}
+		if e.class.size() > maxSplit {
+			return nil, fmt.Errorf("%w: the inverse of %s has %d outputs",
+				ErrWideClass, e, e.class.size())
+		}
+
+		var union *Expr
+		for _, r := range e.class {
+			for symbol := r.lo; symbol <= r.hi; symbol++ {
+				pair := &Expr{kind: PairExpr, in: e.out, out: string(symbol), pos: e.pos}
+				if union == nil {
+					union = pair
+				} else {
+					union = &Expr{
+						kind:     UnionExpr,
+						operands: []*Expr{union, pair},
+						pos:      e.pos,
+					}
+				}
+			}
+		}
+		return union, nil
+
+	default:
+		inverse.operands = make([]*Expr, len(e.operands))
+		for i, o := range e.operands {
+			operand, err := o.Invert()
+			if err != nil {
+				return nil, err
+			}
+			inverse.operands[i] = operand
+		}
+	}
+	return &inverse, nil
+}
+
+// exprPrecedence returns how tightly the expression binds, pairs and classes
+// binding the tightest.
+func exprPrecedence(e *Expr) int {
+	switch e.kind {
+	case UnionExpr, ConcatExpr:
+		return precedence[exprOperators[e.kind]]
+	case PairExpr, ClassExpr:
+		return 4
+	}
+	return 3
+}
+
+// String returns the expression in canonical syntax, which parses to the same
+// tree. Concatenation is written with `.` and parentheses are only added
+// where precedence and associativity require them.
+func (e *Expr) String() string {
+	var b strings.Builder
+	e.write(&b)
+	return b.String()
+}
+
+// write appends the expression in canonical syntax to b.
+func (e *Expr) write(b *strings.Builder) {
+	operand := func(o *Expr, grouped bool) {
+		if grouped {
+			b.WriteByte('(')
+		}
+		o.write(b)
+		if grouped {
+			b.WriteByte(')')
+		}
+	}
+
+	switch e.kind {
+	case PairExpr:
+		b.WriteString("<" + escapePair(e.in, true) + "," + escapePair(e.out, false) + ">")
+
+	case ClassExpr:
+		if e.identity {
+			b.WriteString(e.class.String())
+		} else {
+			b.WriteString("<" + e.class.String() + "," + escapePair(e.out, false) + ">")
+		}
+
+	case UnionExpr, ConcatExpr:
+		left, right := e.operands[0], e.operands[1]
+		operand(left, exprPrecedence(left) < exprPrecedence(e))
+		b.WriteRune(exprOperators[e.kind])
+		operand(right, exprPrecedence(right) <= exprPrecedence(e))
+
+	case RepeatExpr:
+		operand(e.operands[0], exprPrecedence(e.operands[0]) < exprPrecedence(e))
+		switch {
+		case e.min == e.max:
+			fmt.Fprintf(b, "{%d}", e.min)
+		case e.max < 0:
+			fmt.Fprintf(b, "{%d,}", e.min)
+		case e.min == 0:
+			fmt.Fprintf(b, "{,%d}", e.max)
+		default:
+			fmt.Fprintf(b, "{%d,%d}", e.min, e.max)
+		}
+
+	default:
+		operand(e.operands[0], exprPrecedence(e.operands[0]) < exprPrecedence(e))
+		b.WriteRune(exprOperators[e.kind])
+	}
+}
+
+// escapePair escapes one side of a pair so that it is read back unchanged.
+// A `[` starting the input is escaped so that it is not read as a class.
+func escapePair(s string, input bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case strings.ContainsRune(`,<>"\`, r) || input && i == 0 && r == '[':
+			b.WriteString(`\` + string(r))
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case unicode.IsGraphic(r):
+			b.WriteRune(r)
+		default:
+			b.WriteString(`\u{` + strings.ToUpper(strconvHex(r)) + `}`)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package relations
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseExpr(t *testing.T, regexp string) *Expr {
+	e, err := Parse(strings.NewReader(regexp))
+	assert.Nil(t, err, regexp)
+	return e
+}
+
+// sameTree reports whether the expressions have the same structure, ignoring
+// their positions.
+func sameTree(a, b *Expr) bool {
+	if a.kind != b.kind || a.in != b.in || a.out != b.out ||
+		a.class.String() != b.class.String() || a.identity != b.identity ||
+		a.min != b.min || a.max != b.max || len(a.operands) != len(b.operands) {
+		return false
+	}
+	for i := range a.operands {
+		if !sameTree(a.operands[i], b.operands[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParse(t *testing.T) {
+	e := parseExpr(t, "<a,x>+\n  (<b,y> [c-d])*")
+	assert.Equal(t, UnionExpr, e.Kind())
+	assert.Equal(t, Position{Offset: 0, Line: 1, Column: 1}, e.Pos())
+
+	operands := e.Operands()
+	assert.Equal(t, PairExpr, operands[0].Kind())
+	assert.Equal(t, "a", operands[0].Input())
+	assert.Equal(t, "x", operands[0].Output())
+
+	star := operands[1]
+	assert.Equal(t, StarExpr, star.Kind())
+	assert.Equal(t, Position{Offset: 9, Line: 2, Column: 3}, star.Pos())
+
+	concat := star.Operands()[0]
+	assert.Equal(t, ConcatExpr, concat.Kind())
+
+	class := concat.Operands()[1]
+	assert.Equal(t, ClassExpr, class.Kind())
+	assert.Equal(t, "[c-d]", class.Input())
+	assert.True(t, class.Identity())
+	assert.Equal(t, Position{Offset: 16, Line: 2, Column: 10}, class.Pos())
+}
+
+func TestParseExpandsDefinitions(t *testing.T) {
+	e := parseExpr(t, "A = <a,x>;\n{A}{2,}")
+	assert.Equal(t, RepeatExpr, e.Kind())
+	assert.Equal(t, 2, e.Min())
+	assert.Equal(t, -1, e.Max())
+	assert.Equal(t, PairExpr, e.Operands()[0].Kind())
+	assert.Equal(t, Position{Offset: 11, Line: 2, Column: 1}, e.Pos())
+}
+
+func TestExprIsImmutable(t *testing.T) {
+	e := parseExpr(t, `<a,x>.<b,y>`)
+	e.Operands()[0] = nil
+	assert.NotNil(t, e.Operands()[0])
+}
+
+func TestExprString(t *testing.T) {
+	for regexp, canonical := range map[string]string{
+		`<a,x> <b,y>`:             `<a,x>.<b,y>`,
+		`<a,x>+(<b,y>+<c,z>)`:     `<a,x>+(<b,y>+<c,z>)`,
+		`(<a,x>+<b,y>)+<c,z>`:     `<a,x>+<b,y>+<c,z>`,
+		`(<a,x>.<b,y>)*?`:         `(<a,x>.<b,y>)*?`,
+		`((<a,x>))^{2,3}`:         `<a,x>^{2,3}`,
+		`<a,>{,2}<b,>{1,}<c,>{3}`: `<a,>{,2}.<b,>{1,}.<c,>{3}`,
+		`<"a,b",\<\n>`:            `<a\,b,\<\n>`,
+		`<\[,[>`:                  `<\[,[>`,
+		`<[a-c\]],x>+[^0-9]`:      `<[\]a-c],x>+[\u{1}-/:-\u{10FFFF}]`,
+		`(<a,x>+<b,y>).<c,z>`:     `(<a,x>+<b,y>).<c,z>`,
+		`<a,x>+[]+<[],y>`:         `<a,x>+[]+<[],y>`,
+	} {
+		e := parseExpr(t, regexp)
+		assert.Equal(t, canonical, e.String(), regexp)
+
+		reparsed := parseExpr(t, e.String())
+		assert.True(t, sameTree(e, reparsed), regexp)
+		assert.Equal(t, canonical, reparsed.String(), regexp)
+	}
+}
+
+func TestBuildExpr(t *testing.T) {
+	e := parseExpr(t, `<a,x>.<b,y>*`)
+
+	rr, err := BuildExpr(context.Background(), e, BuildOptions{})
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("abb")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"xyy"}, out)
+}
+
+func TestExprInvert(t *testing.T) {
+	e := parseExpr(t, `(<1,one>+<2,two>)[a-b]*<[xy],!>`)
+	inverse, err := e.Invert()
+	assert.Nil(t, err)
+	assert.Equal(t, `(<one,1>+<two,2>).[a-b]*.(<!,x>+<!,y>)`, inverse.String())
+
+	rr, err := BuildExpr(context.Background(), inverse, BuildOptions{})
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("twoab!")
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []string{"2abx", "2aby"}, out)
+}
+
+func TestExprInvertWideClass(t *testing.T) {
+	_, err := parseExpr(t, `<a,b>.<[^],x>`).Invert()
+	assert.True(t, errors.Is(err, ErrWideClass))
+	assert.Contains(t, err.Error(), "has 1114111 outputs")
+}
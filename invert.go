@@ -0,0 +1,189 @@
+package relations
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// transducer returns a transducer with the same states and transitions as
+// the subsequential transducer.
+func (s *RegularRelation) transducer() *transducer {
+	tr := &transducer{prefix: s.prefix}
+
+	states := map[*sState]*tState{}
+	for _, state := range s.states() {
+		t := &tState{
+			index:    len(tr.states) + 1,
+			next:     map[rune][]*tTransition{},
+			final:    state.final,
+			finalOut: state.finalOut,
+		}
+		states[state] = t
+		tr.states = append(tr.states, t)
+	}
+
+	for state, t := range states {
+		for symbol, next := range state.next {
+			t.next[symbol] = []*tTransition{{
+				state: states[next],
+				out:   state.out[symbol],
+			}}
+		}
+		for _, r := range state.ranges {
+			t.classes = append(t.classes, &tClassTransition{
+				class:    charClass{{r.lo, r.hi}},
+				state:    states[r.next],
+				out:      r.out,
+				identity: r.identity,
+			})
+		}
+	}
+	tr.root = states[s.start]
+
+	return tr
+}
+
+// invert returns a transducer with the input and output tapes swapped. The
+// result has transitions on epsilon. Transitions on a character class with
+// constant output are inverted one symbol of the class at a time, which is
+// reported with ErrWideClass for classes of more than maxSplit symbols.
+func (t *transducer) invert() (*transducer, error) {
+	inverse := &transducer{}
+
+	addState := func() *tState {
+		state := &tState{
+			index: len(inverse.states) + 1,
+			next:  map[rune][]*tTransition{},
+		}
+		inverse.states = append(inverse.states, state)
+		return state
+	}
+
+	// chain adds transitions from source to target that consume the input
+	// and put out the output with the first one.
+	chain := func(source, target *tState, input, output string) {
+		symbols := []rune(input)
+		if len(symbols) == 0 {
+			symbols = []rune{epsilon}
+		}
+
+		for i, symbol := range symbols {
+			next := target
+			if i != len(symbols)-1 {
+				next = addState()
+			}
+
+			source.next[symbol] = append(source.next[symbol],
+				&tTransition{state: next, out: output})
+			source, output = next, ""
+		}
+	}
+
+	states := map[*tState]*tState{}
+	for _, state := range t.states {
+		states[state] = addState()
+	}
+
+	for _, state := range t.states {
+		for in, transitions := range state.next {
+			out := string(in)
+			if in == epsilon {
+				out = ""
+			}
+			for _, tr := range transitions {
+				chain(states[state], states[tr.state], tr.out, out)
+			}
+		}
+
+		for _, c := range state.classes {
+			if c.identity < 0 {
+				if c.class.size() > maxSplit {
+					return nil, fmt.Errorf("%w: the inverse of a class with output %q has %d outputs",
+						ErrWideClass, c.out, c.class.size())
+				}
+				for _, r := range c.class {
+					for symbol := r.lo; symbol <= r.hi; symbol++ {
+						chain(states[state], states[c.state], c.out, string(symbol))
+					}
+				}
+				continue
+			}
+
+			// Read the output around the symbol, which is put out as it is.
+			source, target := states[state], states[c.state]
+			if before := c.out[:c.identity]; before != "" {
+				next := addState()
+				chain(source, next, before, "")
+				source = next
+			}
+			if after := c.out[c.identity:]; after != "" {
+				next := addState()
+				chain(next, target, after, "")
+				target = next
+			}
+			source.classes = append(source.classes,
+				&tClassTransition{class: c.class, state: target, identity: 0})
+		}
+
+		if !state.final {
+			continue
+		}
+
+		finalOut := state.finalOut
+		if len(finalOut) == 0 {
+			finalOut = []string{""}
+		}
+		for _, o := range finalOut {
+			if o == "" {
+				states[state].final = true
+				continue
+			}
+
+			final := addState()
+			final.final = true
+			chain(states[state], final, o, "")
+		}
+	}
+
+	inverse.root = states[t.root]
+	if t.prefix != "" {
+		inverse.root = addState()
+		chain(inverse.root, states[t.root], t.prefix, "")
+	}
+
+	return inverse, nil
+}
+
+// inverse builds a RegularRelation from the inverse of the transducer.
+func (t *transducer) inverse() (*RegularRelation, error) {
+	inverse, err := t.invert()
+	if err != nil {
+		return nil, err
+	}
+	if err := inverse.removeEpsilons(); err != nil {
+		return nil, err
+	}
+
+	return subsequentialize(context.Background(), inverse, BuildOptions{})
+}
+
+// BuildInverse builds a RegularRelation subsequential transducer from the
+// input regular relation expression with its input and output swapped.
+// ErrNotSubsequential is reported if the inverse is not a (p-)subsequential
+// function.
+func BuildInverse(source io.Reader) (*RegularRelation, error) {
+	tr, err := newTransducer(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return tr.inverse()
+}
+
+// Invert builds a RegularRelation with the input and output of this one
+// swapped. ErrNotSubsequential is reported if the inverse is not a
+// (p-)subsequential function.
+func (s *RegularRelation) Invert() (*RegularRelation, error) {
+	return s.transducer().inverse()
+}
@@ -0,0 +1,98 @@
+package relations
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvert(t *testing.T) {
+	rr := buildRelation(t, `<1,one>+<2,two>+<3,three>`)
+
+	inverse, err := rr.Invert()
+	assert.Nil(t, err)
+
+	for in, out := range map[string]string{"one": "1", "two": "2", "three": "3"} {
+		result, ok := inverse.Transduce(in)
+		assert.True(t, ok)
+		assert.Equal(t, []string{out}, result)
+	}
+
+	_, ok := inverse.Transduce("tw")
+	assert.False(t, ok)
+}
+
+func TestInvertTwice(t *testing.T) {
+	rr := buildRelation(t, `(<ab,x>+<c,yz>)*.<d,>`)
+
+	inverse, err := rr.Invert()
+	assert.Nil(t, err)
+
+	out, ok := inverse.Transduce("xyzx")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"abcabd"}, out)
+
+	original, err := inverse.Invert()
+	assert.Nil(t, err)
+
+	out, ok = original.Transduce("abcabd")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"xyzx"}, out)
+}
+
+func TestInvertMinimized(t *testing.T) {
+	rr := buildRelation(t, `<a,xy>+<b,xz>`)
+	rr.Minimize()
+
+	inverse, err := rr.Invert()
+	assert.Nil(t, err)
+
+	out, ok := inverse.Transduce("xz")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"b"}, out)
+}
+
+func TestInvertSeveralOutputs(t *testing.T) {
+	inverse, err := BuildInverse(strings.NewReader(`<a,x>+<b,x>+<c,y>`))
+	assert.Nil(t, err)
+
+	out, ok := inverse.Transduce("x")
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []string{"a", "b"}, out)
+}
+
+func TestInvertNotSubsequential(t *testing.T) {
+	_, err := BuildInverse(strings.NewReader(`<a,>*.<b,x>`))
+	assert.True(t, errors.Is(err, ErrNotSubsequential))
+
+	_, err = BuildInverse(strings.NewReader(`(<a,x>*.<b,>)+(<c,x>*.<d,>)`))
+	assert.True(t, errors.Is(err, ErrNotSubsequential))
+}
+
+func TestInvertClasses(t *testing.T) {
+	rr := buildRelation(t, `[a-z]*<[0-2],#>`)
+
+	inverse, err := rr.Invert()
+	assert.Nil(t, err)
+
+	out, ok := inverse.Transduce("a#")
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []string{"a0", "a1", "a2"}, out)
+}
+
+func TestInvertWideClass(t *testing.T) {
+	rr := buildRelation(t, `<[^],x>`)
+	_, err := rr.Invert()
+	assert.True(t, errors.Is(err, ErrWideClass))
+
+	_, err = BuildInverse(strings.NewReader(`<\p{L},x>`))
+	assert.True(t, errors.Is(err, ErrWideClass))
+
+	inverse, err := BuildInverse(strings.NewReader(`[^]*`))
+	assert.Nil(t, err)
+	out, ok := inverse.Transduce("ok")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ok"}, out)
+}
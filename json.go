@@ -0,0 +1,185 @@
+package relations
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// The JSON encoding of a RegularRelation is an object
+//
+//	{
+//	  "prefix": "pre",
+//	  "states": [
+//	    {
+//	      "final": false,
+//	      "transitions": [{"in": "a", "out": "x", "next": 1}],
+//	      "ranges": [{"from": "b", "to": "z", "out": "y", "identity": 1, "next": 1}]
+//	    },
+//	    {"final": true, "finalOut": ["", "s"]}
+//	  ]
+//	}
+//
+// where the first state is the start state and next is the index of the
+// target state. Transitions read the single symbol in and write out. Ranges
+// read any symbol from from to to and write out with the symbol inserted at
+// the byte offset identity, or out alone if identity is absent. Transitions
+// are sorted by input and ranges are sorted and overlap neither each other
+// nor the transitions. Empty lists are left out.
+
+type jsonRelation struct {
+	Prefix string      `json:"prefix"`
+	States []jsonState `json:"states"`
+}
+
+type jsonState struct {
+	Final       bool             `json:"final"`
+	FinalOut    []string         `json:"finalOut,omitempty"`
+	Transitions []jsonTransition `json:"transitions,omitempty"`
+	Ranges      []jsonRange      `json:"ranges,omitempty"`
+}
+
+type jsonTransition struct {
+	In   string `json:"in"`
+	Out  string `json:"out"`
+	Next int    `json:"next"`
+}
+
+type jsonRange struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Out      string `json:"out"`
+	Identity *int   `json:"identity,omitempty"`
+	Next     int    `json:"next"`
+}
+
+// MarshalJSON encodes the transducer as JSON for inspection and rendering.
+func (s *RegularRelation) MarshalJSON() ([]byte, error) {
+	states := s.states()
+	index := map[*sState]int{}
+	for i, state := range states {
+		index[state] = i
+	}
+
+	r := jsonRelation{Prefix: s.prefix, States: make([]jsonState, len(states))}
+	for i, state := range states {
+		js := jsonState{Final: state.final, FinalOut: state.finalOut}
+		for _, symbol := range state.symbols() {
+			js.Transitions = append(js.Transitions, jsonTransition{
+				In:   string(symbol),
+				Out:  state.out[symbol],
+				Next: index[state.next[symbol]],
+			})
+		}
+		for _, sr := range state.ranges {
+			jr := jsonRange{
+				From: string(sr.lo),
+				To:   string(sr.hi),
+				Out:  sr.out,
+				Next: index[sr.next],
+			}
+			if sr.identity >= 0 {
+				identity := sr.identity
+				jr.Identity = &identity
+			}
+			js.Ranges = append(js.Ranges, jr)
+		}
+		r.States[i] = js
+	}
+
+	return json.Marshal(r)
+}
+
+// jsonSymbol returns the symbol of a string with exactly one rune.
+func jsonSymbol(s string) (rune, bool) {
+	symbol, size := utf8.DecodeRuneInString(s)
+	return symbol, size == len(s) && symbol != utf8.RuneError && symbol != epsilon
+}
+
+// UnmarshalJSON decodes a transducer encoded by MarshalJSON. Transducers that
+// are not deterministic on input, refer to missing states or have final
+// states without final outputs are reported with ErrInvalidFormat.
+func (s *RegularRelation) UnmarshalJSON(data []byte) error {
+	var r jsonRelation
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+
+	if len(r.States) == 0 {
+		return fmt.Errorf("%w: no start state", ErrInvalidFormat)
+	}
+
+	states := make([]*sState, len(r.States))
+	for i := range states {
+		states[i] = newSState()
+	}
+
+	for i, js := range r.States {
+		state := states[i]
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%w: state %d: %s", ErrInvalidFormat, i,
+				fmt.Sprintf(format, args...))
+		}
+
+		switch {
+		case !js.Final && len(js.FinalOut) != 0:
+			return fail("final outputs of a state that is not final")
+		case js.Final && len(js.FinalOut) == 0:
+			return fail("final state without final outputs")
+		}
+		state.final = js.Final
+		state.finalOut = js.FinalOut
+
+		for _, t := range js.Transitions {
+			symbol, ok := jsonSymbol(t.In)
+			switch {
+			case !ok:
+				return fail("invalid input %q", t.In)
+			case t.Next < 0 || t.Next >= len(states):
+				return fail("transition to missing state %d", t.Next)
+			}
+			if _, ok := state.next[symbol]; ok {
+				return fail("duplicate transition on %q", symbol)
+			}
+			state.next[symbol] = states[t.Next]
+			state.out[symbol] = t.Out
+		}
+
+		for _, jr := range js.Ranges {
+			lo, loOK := jsonSymbol(jr.From)
+			hi, hiOK := jsonSymbol(jr.To)
+			identity := -1
+			if jr.Identity != nil {
+				identity = *jr.Identity
+			}
+
+			switch {
+			case !loOK || !hiOK || lo > hi:
+				return fail("invalid range %q-%q", jr.From, jr.To)
+			case len(state.ranges) != 0 && lo <= state.ranges[len(state.ranges)-1].hi:
+				return fail("unsorted range %q-%q", jr.From, jr.To)
+			case jr.Next < 0 || jr.Next >= len(states):
+				return fail("transition to missing state %d", jr.Next)
+			case identity < -1 || identity > len(jr.Out) ||
+				identity >= 0 && identity < len(jr.Out) && !utf8.RuneStart(jr.Out[identity]):
+				return fail("invalid identity offset %d", identity)
+			}
+			for symbol := range state.next {
+				if symbol >= lo && symbol <= hi {
+					return fail("duplicate transition on %q", symbol)
+				}
+			}
+
+			state.ranges = append(state.ranges, &sRange{
+				lo:       lo,
+				hi:       hi,
+				next:     states[jr.Next],
+				out:      jr.Out,
+				identity: identity,
+			})
+		}
+	}
+
+	*s = RegularRelation{start: states[0], prefix: r.Prefix}
+	return nil
+}
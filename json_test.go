@@ -0,0 +1,117 @@
+package relations
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	rr := buildRelation(t, `<a,xy>+<b,xz>+<b,xw>`)
+	rr.Minimize()
+
+	data, err := json.Marshal(rr)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"prefix": "x",
+		"states": [
+			{
+				"final": false,
+				"transitions": [
+					{"in": "a", "out": "y", "next": 1},
+					{"in": "b", "out": "", "next": 2}
+				]
+			},
+			{"final": true, "finalOut": [""]},
+			{"final": true, "finalOut": ["w", "z"]}
+		]
+	}`, string(data))
+}
+
+func TestMarshalJSONRanges(t *testing.T) {
+	rr := buildRelation(t, `[a-c]<d,x>+<ж,y>`)
+	rr.Minimize()
+
+	data, err := json.Marshal(rr)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data),
+		`"ranges":[{"from":"a","to":"c","out":"x","identity":0,"next":2}]`)
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, regexp := range []string{
+		`(<ab,x>+<aж,yz>).(<c,>+<d,w>)*`,
+		`(<ß,ss>+[^ß])*`,
+		`<[0-9],#>*<a,b>`,
+		`<a,x>+<a,y>`,
+	} {
+		rr := buildRelation(t, regexp)
+		data, err := json.Marshal(rr)
+		assert.Nil(t, err)
+
+		var read RegularRelation
+		assert.Nil(t, json.Unmarshal(data, &read), regexp)
+
+		again, err := json.Marshal(&read)
+		assert.Nil(t, err)
+		assert.Equal(t, string(data), string(again))
+
+		for _, in := range []string{"", "a", "aжcc", "abd", "ßx", "12a", "1"} {
+			expected, ok := rr.Transduce(in)
+			result, readOk := read.Transduce(in)
+			assert.Equal(t, ok, readOk, regexp+" "+in)
+			assert.Equal(t, expected, result, regexp+" "+in)
+		}
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tests := []struct {
+		data    string
+		message string
+	}{
+		{`{"states": []}`, "no start state"},
+		{`{"states": [{"transitions": [{"in": "a", "next": 1}]}]}`,
+			"state 0: transition to missing state 1"},
+		{`{"states": [{"transitions": [{"in": "a", "next": -1}]}]}`,
+			"state 0: transition to missing state -1"},
+		{`{"states": [{"transitions": [{"in": "a", "next": 0}, {"in": "a", "next": 0}]}]}`,
+			`state 0: duplicate transition on 'a'`},
+		{`{"states": [{"transitions": [{"in": "ab", "next": 0}]}]}`,
+			`state 0: invalid input "ab"`},
+		{`{"states": [{"transitions": [{"in": "", "next": 0}]}]}`,
+			`state 0: invalid input ""`},
+		{`{"states": [{"final": false, "finalOut": ["x"]}]}`,
+			"state 0: final outputs of a state that is not final"},
+		{`{"states": [{"final": true}]}`,
+			"state 0: final state without final outputs"},
+		{`{"states": [{"transitions": [{"in": "a", "next": 1}]}, {"final": true, "finalOut": []}]}`,
+			"state 1: final state without final outputs"},
+		{`{"states": [{"ranges": [{"from": "c", "to": "a", "next": 0}]}]}`,
+			`state 0: invalid range "c"-"a"`},
+		{`{"states": [{"ranges": [{"from": "a", "to": "c", "next": 0},
+			{"from": "b", "to": "d", "next": 0}]}]}`,
+			`state 0: unsorted range "b"-"d"`},
+		{`{"states": [{"transitions": [{"in": "b", "next": 0}],
+			"ranges": [{"from": "a", "to": "c", "next": 0}]}]}`,
+			`state 0: duplicate transition on 'b'`},
+		{`{"states": [{"ranges": [{"from": "a", "to": "c", "next": 2}]}]}`,
+			"state 0: transition to missing state 2"},
+		{`{"states": [{"ranges": [{"from": "a", "to": "c", "out": "ж", "identity": 1, "next": 0}]}]}`,
+			"state 0: invalid identity offset 1"},
+		{`{"states": [{}, {"transitions": [{"in": "a", "next": 5}]}]}`,
+			"state 1: transition to missing state 5"},
+	}
+
+	for _, test := range tests {
+		var rr RegularRelation
+		err := json.Unmarshal([]byte(test.data), &rr)
+		assert.True(t, errors.Is(err, ErrInvalidFormat), test.data)
+		assert.EqualError(t, err, "invalid relation data: "+test.message)
+	}
+
+	var rr RegularRelation
+	assert.NotNil(t, json.Unmarshal([]byte(`{"states": 1}`), &rr))
+}
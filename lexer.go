@@ -0,0 +1,672 @@
+package relations
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// eof is the kind of the token returned at the end of the input.
+const eof = -1
+
+// position is a location in the source of a regular expression.
+type position struct {
+	offset int // byte offset, starting from 0
+	line   int // line number, starting from 1
+	column int // column in runes, starting from 1
+}
+
+// scanner reads runes from the source while keeping track of their position.
+type scanner struct {
+	reader *bufio.Reader
+	pos    position
+}
+
+func newScanner(source io.Reader) *scanner {
+	return &scanner{
+		reader: bufio.NewReader(source),
+		pos:    position{line: 1, column: 1},
+	}
+}
+
+// next returns the next rune from the source and the position it starts at.
+func (s *scanner) next() (rune, position, error) {
+	pos := s.pos
+
+	char, size, err := s.reader.ReadRune()
+	if err != nil {
+		return 0, pos, err
+	}
+
+	s.pos.offset += size
+	if char == '\n' {
+		s.pos.line++
+		s.pos.column = 1
+	} else {
+		s.pos.column++
+	}
+
+	return char, pos, nil
+}
+
+// peek returns the next rune from the source without consuming it, or eof
+// if there is none.
+func (s *scanner) peek() rune {
+	char, _, err := s.reader.ReadRune()
+	if err != nil {
+		return eof
+	}
+	s.reader.UnreadRune()
+	return char
+}
+
+// token is a lexical element of a regular expression. Pairs have kind `<`,
+// operators and parentheses are their own kind. Counted repetitions have
+// kind `{` and their bounds in min and max, negative max meaning no bound.
+// Pairs whose input is a character class have it in class instead of in,
+// and identity is set when each symbol of the class maps to itself.
+// Identifiers and references to definitions have the defined name in name.
+type token struct {
+	kind     rune
+	in       string
+	out      string
+	class    charClass
+	identity bool
+	min      int
+	max      int
+	name     string
+	text     string
+	pos      position
+}
+
+// lexer splits a regular expression into tokens. Juxtaposed operands are
+// separated by an implicit concatenation token.
+type lexer struct {
+	scanner *scanner
+	prev    rune   // kind of the last returned token
+	pending *token // token to return after an implicit concatenation
+}
+
+func newLexer(source io.Reader) *lexer {
+	return &lexer{scanner: newScanner(source), prev: eof}
+}
+
+// startsOperand reports whether a token of the given kind begins an operand.
+func startsOperand(kind rune) bool {
+	return kind == '<' || kind == '(' || kind == reference
+}
+
+// endsOperand reports whether a token of the given kind ends an operand.
+func endsOperand(kind rune) bool {
+	switch kind {
+	case '<', ')', reference, repeat, optional, oneOrMore, repetition:
+		return true
+	}
+	return false
+}
+
+// next returns the next token from the source.
+func (l *lexer) next() (token, error) {
+	var t token
+	if l.pending != nil {
+		t, l.pending = *l.pending, nil
+	} else {
+		var err error
+		if t, err = l.scan(); err != nil {
+			return token{}, err
+		}
+
+		if endsOperand(l.prev) && startsOperand(t.kind) {
+			operand := t
+			l.pending = &operand
+			t = token{kind: concat, pos: t.pos}
+		}
+	}
+
+	l.prev = t.kind
+	return t, nil
+}
+
+// scan reads the next token written in the source. Whitespace and comments
+// from `#` to the end of the line are skipped between tokens.
+func (l *lexer) scan() (token, error) {
+	for {
+		char, pos, err := l.scanner.next()
+		if err == io.EOF {
+			return token{kind: eof, pos: pos}, nil
+		} else if err != nil {
+			return token{}, err
+		}
+
+		switch char {
+		case '<':
+			return l.pair(pos)
+		case '(', ')', union, concat, repeat, optional, oneOrMore:
+			return token{kind: char, text: string(char), pos: pos}, nil
+		case repetition:
+			if isNameStart(l.scanner.peek()) {
+				return l.reference(pos)
+			}
+			return l.repetition(pos)
+		case define, terminator:
+			return token{kind: char, text: string(char), pos: pos}, nil
+		case '[':
+			return l.identity(pos, char, l.class)
+		case '\\':
+			if l.peekProperty() {
+				return l.identity(pos, char, l.property)
+			}
+			return token{}, newSyntaxError(
+				token{text: string(char), pos: pos}, "expected '<' to start a pair")
+		case ',', '>', '"':
+			return token{}, newSyntaxError(
+				token{text: string(char), pos: pos}, "expected '<' to start a pair")
+		}
+
+		switch {
+		case isNameStart(char):
+			name := l.name(char)
+			return token{kind: identifier, name: name, text: name, pos: pos}, nil
+		case unicode.IsSpace(char):
+		case char == '#':
+			if err := l.comment(); err != nil {
+				return token{}, err
+			}
+		default:
+			return token{}, newSyntaxError(token{text: string(char), pos: pos},
+				"expected an operand or operator")
+		}
+	}
+}
+
+// comment consumes the rest of a `#` comment up to the end of the line.
+func (l *lexer) comment() error {
+	for {
+		char, _, err := l.scanner.next()
+		if err == io.EOF || char == '\n' {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// isNameStart reports whether a name can start with the character.
+func isNameStart(char rune) bool {
+	return unicode.IsLetter(char) || char == '_'
+}
+
+// name consumes the rest of the name starting with first.
+func (l *lexer) name(first rune) string {
+	name := []rune{first}
+	for {
+		char := l.scanner.peek()
+		if !isNameStart(char) && !unicode.IsDigit(char) {
+			return string(name)
+		}
+
+		l.scanner.next()
+		name = append(name, char)
+	}
+}
+
+// reference consumes the rest of a {Name} reference to a definition whose
+// `{` is at pos.
+func (l *lexer) reference(pos position) (token, error) {
+	first, _, err := l.scanner.next()
+	if err != nil {
+		return token{}, err
+	}
+	name := l.name(first)
+	text := "{" + name
+
+	char, _, err := l.scanner.next()
+	if err != nil && err != io.EOF {
+		return token{}, err
+	} else if err == io.EOF || char != '}' {
+		if err == nil {
+			text += string(char)
+		}
+		return token{}, newSyntaxError(token{text: text, pos: pos},
+			"expected '}' to close the reference")
+	}
+
+	return token{kind: reference, name: name, text: text + "}", pos: pos}, nil
+}
+
+// maxRepetition is the largest count of a repetition, which limits the
+// number of copies of the repeated subexpression.
+const maxRepetition = 1000
+
+// repetition consumes the rest of a {min,max} counted repetition whose `{`
+// is at pos. The forms {n}, {min,} and {,max} are also accepted.
+func (l *lexer) repetition(pos position) (token, error) {
+	text := &bytes.Buffer{}
+	text.WriteRune(repetition)
+
+	invalid := func(expected string) error {
+		return newSyntaxError(token{text: text.String(), pos: pos}, expected)
+	}
+
+	bounds := [2]*bytes.Buffer{{}, {}}
+	side := 0
+	for {
+		char, _, err := l.scanner.next()
+		if err == io.EOF {
+			return token{}, invalid("expected '}' to close the repetition")
+		} else if err != nil {
+			return token{}, err
+		}
+		text.WriteRune(char)
+
+		if char == '}' {
+			break
+		} else if char == ',' && side == 0 {
+			side = 1
+		} else if char >= '0' && char <= '9' {
+			bounds[side].WriteRune(char)
+		} else {
+			return token{}, invalid("expected a count")
+		}
+	}
+
+	// count parses a bound, reporting counts above maxRepetition at the
+	// position of the bound. The digits are one byte and column each.
+	count := func(side int) (int, error) {
+		n, err := strconv.Atoi(bounds[side].String())
+		if err == nil && n <= maxRepetition {
+			return n, nil
+		}
+
+		at := pos
+		skip := 1
+		if side == 1 {
+			skip += bounds[0].Len() + 1
+		}
+		at.offset += skip
+		at.column += skip
+		return 0, newSyntaxError(token{text: bounds[side].String(), pos: at},
+			fmt.Sprintf("expected a count of at most %d", maxRepetition))
+	}
+
+	t := token{kind: repetition, text: text.String(), pos: pos}
+
+	var err error
+	if bounds[0].Len() != 0 {
+		if t.min, err = count(0); err != nil {
+			return token{}, err
+		}
+	}
+
+	switch {
+	case side == 0 && bounds[0].Len() == 0:
+		return token{}, invalid("expected a count")
+	case side == 0:
+		t.max = t.min
+	case bounds[1].Len() == 0:
+		t.max = -1
+	default:
+		if t.max, err = count(1); err != nil {
+			return token{}, err
+		}
+	}
+
+	if t.max == 0 {
+		return token{}, invalid("expected a positive maximum count")
+	} else if t.max > 0 && t.max < t.min {
+		return token{}, invalid("expected the minimum not to exceed the maximum")
+	}
+
+	return t, nil
+}
+
+// escapes maps the characters following a backslash to the rune they stand
+// for. `\u{...}` is handled separately.
+var escapes = map[rune]rune{
+	',': ',', '<': '<', '>': '>', '"': '"', '\\': '\\',
+	'[': '[', ']': ']', '-': '-', '^': '^',
+	'n': '\n', 't': '\t', 'r': '\r',
+}
+
+// escape consumes the rest of an escape sequence whose backslash is at pos
+// and returns the rune it stands for.
+func (l *lexer) escape(pos position, text *bytes.Buffer) (rune, error) {
+	start := text.Len() - 1
+
+	// invalid reports the escape sequence read so far.
+	invalid := func(expected string) error {
+		return newSyntaxError(
+			token{text: text.String()[start:], pos: pos}, expected)
+	}
+
+	char, _, err := l.scanner.next()
+	if err != nil && err != io.EOF {
+		return 0, err
+	} else if err == io.EOF {
+		return 0, invalid("expected escaped character")
+	}
+	text.WriteRune(char)
+
+	if r, ok := escapes[char]; ok {
+		return r, nil
+	} else if char != 'u' {
+		return 0, invalid("unknown escape sequence")
+	}
+
+	// Read the \u{hex} code point.
+	var code rune
+	for digits := -1; ; digits++ {
+		char, _, err = l.scanner.next()
+		if err != nil && err != io.EOF {
+			return 0, err
+		} else if err == io.EOF {
+			return 0, invalid("expected '}' to close the code point")
+		}
+		text.WriteRune(char)
+
+		switch {
+		case digits == -1:
+			if char != '{' {
+				return 0, invalid("expected '{' after \\u")
+			}
+		case char == '}':
+			if digits == 0 || code == 0 || code > unicode.MaxRune ||
+				!utf8.ValidRune(code) {
+				return 0, invalid("expected a valid non-zero code point")
+			}
+			return code, nil
+		case digits < 6 && unicode.Is(unicode.ASCII_Hex_Digit, char):
+			digit, _ := strconv.ParseUint(string(char), 16, 8)
+			code = code<<4 | rune(digit)
+		default:
+			return 0, invalid("expected up to 6 hexadecimal digits and '}'")
+		}
+	}
+}
+
+// peekProperty reports whether a backslash just read starts a Unicode
+// property.
+func (l *lexer) peekProperty() bool {
+	char := l.scanner.peek()
+	return char == 'p' || char == 'P'
+}
+
+// identity returns the token of a character class written outside of a pair,
+// which maps each of its symbols to itself. read consumes the rest of the
+// class whose first character char is at pos.
+func (l *lexer) identity(pos position, char rune,
+	read func(position, *bytes.Buffer) (charClass, error)) (token, error) {
+
+	text := &bytes.Buffer{}
+	text.WriteRune(char)
+
+	class, err := read(pos, text)
+	if err != nil {
+		return token{}, err
+	}
+
+	return token{
+		kind:     '<',
+		class:    class,
+		identity: true,
+		text:     text.String(),
+		pos:      pos,
+	}, nil
+}
+
+// class consumes the rest of a [...] character class whose `[` is at pos and
+// is the last character of text. A leading `^` negates the class, so `[^]`
+// stands for any symbol, while `[]` is the empty class that matches none. Inside the brackets `]`, `-` and `\` have to be
+// escaped with a backslash and `\p{Name}` adds a Unicode category or script.
+func (l *lexer) class(pos position, text *bytes.Buffer) (charClass, error) {
+	start := text.Len() - 1
+
+	invalid := func(expected string) error {
+		return newSyntaxError(
+			token{text: text.String()[start:], pos: pos}, expected)
+	}
+
+	var ranges []runeRange
+	negated := false
+
+	// canRange is true after a single character, which may start a range,
+	// and inRange after the `-` of a range.
+	canRange, inRange := false, false
+
+	for first := true; ; first = false {
+		char, charPos, err := l.scanner.next()
+		if err == io.EOF {
+			return nil, invalid("expected ']' to close the character class")
+		} else if err != nil {
+			return nil, err
+		}
+		text.WriteRune(char)
+
+		var r rune
+		switch {
+		case char == '^' && first:
+			negated = true
+			continue
+
+		case char == ']':
+			if inRange {
+				return nil, invalid("expected a character after '-'")
+			}
+			if len(ranges) == 0 && !negated {
+				// The empty class, which relates no strings at all. It
+				// is not nil, which would mean a pair without class.
+				return charClass{}, nil
+			}
+
+			class := newCharClass(ranges...)
+			if negated {
+				class = class.negate()
+			}
+			if len(class) == 0 {
+				return nil, invalid("expected a class with at least one symbol")
+			}
+			return class, nil
+
+		case char == '\\':
+			if l.peekProperty() {
+				if inRange {
+					return nil, invalid("expected a character after '-'")
+				}
+
+				class, err := l.property(charPos, text)
+				if err != nil {
+					return nil, err
+				}
+				ranges = append(ranges, class...)
+				canRange = false
+				continue
+			}
+
+			if r, err = l.escape(charPos, text); err != nil {
+				return nil, err
+			}
+
+		case char == '-':
+			if !canRange {
+				return nil, newSyntaxError(token{text: "-", pos: charPos},
+					`expected a character before '-', write \- for a '-'`)
+			}
+			canRange, inRange = false, true
+			continue
+
+		default:
+			r = char
+		}
+
+		if inRange {
+			last := &ranges[len(ranges)-1]
+			if r < last.lo {
+				return nil, invalid("expected the range to be in increasing order")
+			}
+			last.hi = r
+			inRange = false
+		} else {
+			ranges = append(ranges, runeRange{r, r})
+			canRange = true
+		}
+	}
+}
+
+// property consumes the rest of a \p{Name} Unicode category or script whose
+// backslash is at pos and is the last character of text. \P{Name} stands for
+// the symbols outside of it.
+func (l *lexer) property(pos position, text *bytes.Buffer) (charClass, error) {
+	start := text.Len() - 1
+
+	invalid := func(expected string) error {
+		return newSyntaxError(
+			token{text: text.String()[start:], pos: pos}, expected)
+	}
+
+	// The `p` or `P` has already been peeked at.
+	kind, _, err := l.scanner.next()
+	if err != nil {
+		return nil, err
+	}
+	text.WriteRune(kind)
+
+	name := &bytes.Buffer{}
+	for opened := false; ; opened = true {
+		char, _, err := l.scanner.next()
+		if err == io.EOF {
+			return nil, invalid("expected '}' to close the property")
+		} else if err != nil {
+			return nil, err
+		}
+		text.WriteRune(char)
+
+		switch {
+		case !opened:
+			if char != '{' {
+				return nil, invalid(fmt.Sprintf("expected '{' after \\%c", kind))
+			}
+		case char == '}':
+			table, ok := unicode.Categories[name.String()]
+			if !ok {
+				table, ok = unicode.Scripts[name.String()]
+			}
+			if !ok {
+				return nil, invalid("expected a Unicode category or script")
+			}
+
+			class := unicodeClass(table)
+			if kind == 'P' {
+				class = class.negate()
+			}
+			return class, nil
+		default:
+			name.WriteRune(char)
+		}
+	}
+}
+
+// pair consumes the rest of an <in, out> pair whose `<` is at pos. Inside
+// the pair `,`, `<`, `>`, `"` and `\` have to be escaped with a backslash
+// unless they appear in a double quoted string. The input may instead be a
+// single character class, in which case each of its symbols is mapped to
+// the output.
+func (l *lexer) pair(pos position) (token, error) {
+	text := &bytes.Buffer{}
+	text.WriteRune('<')
+
+	sides := [2]*bytes.Buffer{{}, {}}
+	side := 0
+
+	// Position of the opening quote while inside a quoted string.
+	var quote *position
+
+	// Character class on the input side.
+	var class charClass
+
+	for {
+		char, charPos, err := l.scanner.next()
+		if err == io.EOF {
+			if quote != nil {
+				return token{}, newSyntaxError(token{text: `"`, pos: *quote},
+					`expected '"' to close the string`)
+			}
+			return token{}, newSyntaxError(token{text: text.String(), pos: pos},
+				"expected '>' to close the pair")
+		} else if err != nil {
+			return token{}, err
+		}
+
+		text.WriteRune(char)
+		charToken := token{text: string(char), pos: charPos}
+
+		// A class starts only an unquoted input that is otherwise empty.
+		startsClass := side == 0 && quote == nil && class == nil &&
+			sides[0].Len() == 0
+
+		switch {
+		case class != nil && side == 0 && char != ',':
+			return token{}, newSyntaxError(charToken,
+				"expected ',' after the character class")
+
+		case startsClass && char == '[':
+			if class, err = l.class(charPos, text); err != nil {
+				return token{}, err
+			}
+
+		case startsClass && char == '\\' && l.peekProperty():
+			if class, err = l.property(charPos, text); err != nil {
+				return token{}, err
+			}
+
+		case char == '\\':
+			r, err := l.escape(charPos, text)
+			if err != nil {
+				return token{}, err
+			}
+			sides[side].WriteRune(r)
+
+		case char == '"':
+			if quote == nil {
+				quote = &charPos
+			} else {
+				quote = nil
+			}
+
+		case quote != nil:
+			sides[side].WriteRune(char)
+
+		case char == ',':
+			if side == 1 {
+				return token{}, newSyntaxError(charToken,
+					`expected '>' to close the pair, write \, for a comma`)
+			}
+			side = 1
+
+		case char == '>':
+			if side == 0 {
+				return token{}, newSyntaxError(charToken,
+					"expected ',' between input and output")
+			}
+
+			return token{
+				kind:  '<',
+				in:    sides[0].String(),
+				out:   sides[1].String(),
+				class: class,
+				text:  text.String(),
+				pos:   pos,
+			}, nil
+
+		case char == '<':
+			return token{}, newSyntaxError(charToken,
+				`expected '>' to close the pair, write \< for a '<'`)
+
+		default:
+			sides[side].WriteRune(char)
+		}
+	}
+}
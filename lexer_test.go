@@ -0,0 +1,225 @@
+package relations
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScannerPosition(t *testing.T) {
+	s := newScanner(strings.NewReader("aж\nb"))
+
+	_, pos, _ := s.next()
+	assert.Equal(t, position{offset: 0, line: 1, column: 1}, pos)
+
+	_, pos, _ = s.next()
+	assert.Equal(t, position{offset: 1, line: 1, column: 2}, pos)
+
+	_, pos, _ = s.next()
+	assert.Equal(t, position{offset: 3, line: 1, column: 3}, pos)
+
+	_, pos, _ = s.next()
+	assert.Equal(t, position{offset: 4, line: 2, column: 1}, pos)
+}
+
+func TestLexerTokens(t *testing.T) {
+	l := newLexer(strings.NewReader(`(<ab,x>+<c,>)*`))
+
+	var kinds []rune
+	for {
+		tok, err := l.next()
+		assert.Nil(t, err)
+		if tok.kind == eof {
+			break
+		}
+		kinds = append(kinds, tok.kind)
+	}
+	assert.Equal(t, []rune("(<+<)*"), kinds)
+}
+
+func TestLexerPair(t *testing.T) {
+	l := newLexer(strings.NewReader(`<ab,xyz>`))
+
+	tok, err := l.next()
+	assert.Nil(t, err)
+	assert.Equal(t, "ab", tok.in)
+	assert.Equal(t, "xyz", tok.out)
+	assert.Equal(t, "<ab,xyz>", tok.text)
+}
+
+func testPair(t *testing.T, source, in, out string) {
+	tok, err := newLexer(strings.NewReader(source)).next()
+	if assert.Nil(t, err, source) {
+		assert.Equal(t, in, tok.in, source)
+		assert.Equal(t, out, tok.out, source)
+	}
+}
+
+func TestLexerEscapes(t *testing.T) {
+	testPair(t, `<\,\<\>,\\\">`, `,<>`, `\"`)
+	testPair(t, `<a\tb,\n>`, "a\tb", "\n")
+	testPair(t, `<\u{41}\u{1F600},\u{10FFFF}>`, "A\U0001F600", "\U0010FFFF")
+}
+
+func TestLexerQuoted(t *testing.T) {
+	testPair(t, `<"a,b>",x"<>"y>`, `a,b>`, `x<>y`)
+	testPair(t, `<"a\"b","">`, `a"b`, ``)
+	testPair(t, `< a , b >`, ` a `, ` b `)
+}
+
+func testLexerError(t *testing.T, source string, expected *SyntaxError) {
+	_, err := newLexer(strings.NewReader(source)).next()
+	assert.Equal(t, expected, err, source)
+}
+
+func TestLexerPairErrors(t *testing.T) {
+	testLexerError(t, `<a,b,c>`, &SyntaxError{
+		Offset: 4, Line: 1, Column: 5, Token: `,`,
+		Expected: `expected '>' to close the pair, write \, for a comma`,
+	})
+	testLexerError(t, `<ab>`, &SyntaxError{
+		Offset: 3, Line: 1, Column: 4, Token: `>`,
+		Expected: "expected ',' between input and output",
+	})
+	testLexerError(t, `<a<,b>`, &SyntaxError{
+		Offset: 2, Line: 1, Column: 3, Token: `<`,
+		Expected: `expected '>' to close the pair, write \< for a '<'`,
+	})
+	testLexerError(t, `<a,"b>`, &SyntaxError{
+		Offset: 3, Line: 1, Column: 4, Token: `"`,
+		Expected: `expected '"' to close the string`,
+	})
+	testLexerError(t, `>`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: `>`,
+		Expected: "expected '<' to start a pair",
+	})
+}
+
+func TestLexerEscapeErrors(t *testing.T) {
+	testLexerError(t, `<a\q,b>`, &SyntaxError{
+		Offset: 2, Line: 1, Column: 3, Token: `\q`,
+		Expected: "unknown escape sequence",
+	})
+	testLexerError(t, `<\u{110000},b>`, &SyntaxError{
+		Offset: 1, Line: 1, Column: 2, Token: `\u{110000}`,
+		Expected: "expected a valid non-zero code point",
+	})
+	testLexerError(t, `<\u{0},b>`, &SyntaxError{
+		Offset: 1, Line: 1, Column: 2, Token: `\u{0}`,
+		Expected: "expected a valid non-zero code point",
+	})
+	testLexerError(t, `<\u41,b>`, &SyntaxError{
+		Offset: 1, Line: 1, Column: 2, Token: `\u4`,
+		Expected: `expected '{' after \u`,
+	})
+	testLexerError(t, `<\u{4g},b>`, &SyntaxError{
+		Offset: 1, Line: 1, Column: 2, Token: `\u{4g`,
+		Expected: "expected up to 6 hexadecimal digits and '}'",
+	})
+}
+
+func TestLexerImplicitConcatenation(t *testing.T) {
+	l := newLexer(strings.NewReader(`<a,b>(<c,d>)*<e,f>.<g,h>+<i,j>`))
+
+	var kinds []rune
+	for {
+		tok, err := l.next()
+		assert.Nil(t, err)
+		if tok.kind == eof {
+			break
+		}
+		kinds = append(kinds, tok.kind)
+	}
+	assert.Equal(t, []rune("<.(<)*.<.<+<"), kinds)
+}
+
+func TestLexerClasses(t *testing.T) {
+	tok, err := newLexer(strings.NewReader(`[a-c\-x]`)).next()
+	if assert.Nil(t, err) {
+		assert.Equal(t, charClass{{'-', '-'}, {'a', 'c'}, {'x', 'x'}}, tok.class)
+		assert.True(t, tok.identity)
+		assert.Equal(t, `[a-c\-x]`, tok.text)
+	}
+
+	tok, err = newLexer(strings.NewReader(`<[^0-9],#>`)).next()
+	if assert.Nil(t, err) {
+		assert.Equal(t, charClass{{'0', '9'}}.negate(), tok.class)
+		assert.False(t, tok.identity)
+		assert.Equal(t, "#", tok.out)
+	}
+
+	tok, err = newLexer(strings.NewReader(`\p{Greek}`)).next()
+	if assert.Nil(t, err) {
+		assert.True(t, tok.class.contains('λ'))
+		assert.False(t, tok.class.contains('l'))
+	}
+
+	tok, err = newLexer(strings.NewReader(`[^]`)).next()
+	if assert.Nil(t, err) {
+		assert.Equal(t, charClass{{1, unicode.MaxRune}}, tok.class)
+	}
+
+	// Brackets later in the input are plain characters.
+	testPair(t, `<a[,b>`, "a[", "b")
+	testPair(t, `<\[,b>`, "[", "b")
+}
+
+func TestLexerClassErrors(t *testing.T) {
+	testLexerError(t, `[a-`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: `[a-`,
+		Expected: "expected ']' to close the character class",
+	})
+	testLexerError(t, `[z-a]`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: `[z-a`,
+		Expected: "expected the range to be in increasing order",
+	})
+	testLexerError(t, `[a-]`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: `[a-]`,
+		Expected: "expected a character after '-'",
+	})
+	testLexerError(t, `[-a]`, &SyntaxError{
+		Offset: 1, Line: 1, Column: 2, Token: `-`,
+		Expected: `expected a character before '-', write \- for a '-'`,
+	})
+	testLexerError(t, `<[a]b,x>`, &SyntaxError{
+		Offset: 4, Line: 1, Column: 5, Token: `b`,
+		Expected: "expected ',' after the character class",
+	})
+	testLexerError(t, `\p{Klingon}`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: `\p{Klingon}`,
+		Expected: "expected a Unicode category or script",
+	})
+	testLexerError(t, `<\pL,x>`, &SyntaxError{
+		Offset: 1, Line: 1, Column: 2, Token: `\pL`,
+		Expected: `expected '{' after \p`,
+	})
+}
+
+func TestLexerWhitespaceAndComments(t *testing.T) {
+	l := newLexer(strings.NewReader("# header\n<a, b> +\t# union\n\n  < c,d>* # end"))
+
+	var texts []string
+	for {
+		tok, err := l.next()
+		assert.Nil(t, err)
+		if tok.kind == eof {
+			break
+		}
+		texts = append(texts, tok.text)
+	}
+	assert.Equal(t, []string{"<a, b>", "+", "< c,d>", "*"}, texts)
+}
+
+func TestLexerUnexpectedCharacter(t *testing.T) {
+	l := newLexer(strings.NewReader(`<a,b>|<c,d>`))
+
+	_, err := l.next()
+	assert.Nil(t, err)
+	_, err = l.next()
+	assert.Equal(t, &SyntaxError{
+		Offset: 5, Line: 1, Column: 6, Token: "|",
+		Expected: "expected an operand or operator",
+	}, err)
+}
@@ -0,0 +1,65 @@
+package relations
+
+// AppendTransduce appends the output for the input to dst and returns the
+// extended buffer. It reports false and returns dst unchanged if the input
+// is not in the domain of the relation. Of several outputs only the first
+// one returned by Transduce is appended; a Transducer gives all of them.
+// Unlike Transduce it does not allocate unless dst has to grow.
+func (s *RegularRelation) AppendTransduce(dst []byte, input string) ([]byte, bool) {
+	n := len(dst)
+	node, dst, ok := s.appendWalk(dst, input)
+	if !ok || !node.final {
+		return dst[:n], false
+	}
+
+	if len(node.finalOut) != 0 {
+		dst = append(dst, node.finalOut[0]...)
+	}
+	return dst, true
+}
+
+// Transducer transduces inputs with a RegularRelation, reusing its buffers
+// between calls so that lookups do not allocate once they have grown to fit
+// the outputs. A Transducer must not be used by several goroutines at once,
+// but any number of them can share the same relation.
+type Transducer struct {
+	relation *RegularRelation
+	buf      []byte
+	outputs  [][]byte
+}
+
+// NewTransducer returns a Transducer for the relation.
+func NewTransducer(s *RegularRelation) *Transducer {
+	return &Transducer{relation: s}
+}
+
+// Transduce returns the outputs for the input like RegularRelation.Transduce.
+// They refer to the buffers of the Transducer and are only valid until the
+// next call.
+func (t *Transducer) Transduce(input string) ([][]byte, bool) {
+	node, buf, ok := t.relation.appendWalk(t.buf[:0], input)
+	t.buf = buf
+	if !ok || !node.final {
+		return nil, false
+	}
+
+	// The first output continues the output of the walk in place and the
+	// others follow it, each with its own copy.
+	walked := len(t.buf)
+	for i, o := range node.finalOut {
+		if i != 0 {
+			t.buf = append(t.buf, t.buf[:walked]...)
+		}
+		t.buf = append(t.buf, o...)
+	}
+
+	t.outputs = t.outputs[:0]
+	offset := 0
+	for _, o := range node.finalOut {
+		end := offset + walked + len(o)
+		t.outputs = append(t.outputs, t.buf[offset:end:end])
+		offset = end
+	}
+
+	return t.outputs, true
+}
@@ -0,0 +1,111 @@
+package relations
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendTransduce(t *testing.T) {
+	rr := buildRelation(t, `<ab,x>+<a,y>+<a,z>+[c-e]`)
+
+	out, ok := rr.AppendTransduce([]byte("> "), "ab")
+	assert.True(t, ok)
+	assert.Equal(t, "> x", string(out))
+
+	out, ok = rr.AppendTransduce([]byte("> "), "d")
+	assert.True(t, ok)
+	assert.Equal(t, "> d", string(out))
+
+	out, ok = rr.AppendTransduce([]byte("> "), "abc")
+	assert.False(t, ok)
+	assert.Equal(t, "> ", string(out))
+
+	expected, _ := rr.Transduce("a")
+	out, ok = rr.AppendTransduce(nil, "a")
+	assert.True(t, ok)
+	assert.Equal(t, expected[0], string(out))
+}
+
+func TestTransducerOutputs(t *testing.T) {
+	rr := buildRelation(t, `<,pre>(<a,x>+<b,>+[c-e])*(<f,y>+<f,z>)?`)
+	tr := NewTransducer(rr)
+
+	for _, in := range []string{"", "a", "aa", "bda", "cabf", "f", "afa", "g"} {
+		expected, ok := rr.Transduce(in)
+		outputs, trOk := tr.Transduce(in)
+		assert.Equal(t, ok, trOk, in)
+
+		var result []string
+		for _, o := range outputs {
+			result = append(result, string(o))
+		}
+		assert.Equal(t, expected, result, in)
+	}
+}
+
+func TestLookupsDoNotAllocate(t *testing.T) {
+	rr := buildRelation(t, `(<ß,ss>+[^ß0-9]+<[0-9],#>)*`)
+	rr.Minimize()
+	input := "Straße 42"
+
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = rr.AppendTransduce(buf[:0], input)
+	})
+	assert.Equal(t, 0.0, allocs)
+	assert.Equal(t, "Strasse ##", string(buf))
+
+	tr := NewTransducer(rr)
+	allocs = testing.AllocsPerRun(100, func() {
+		tr.Transduce(input)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+// TestConcurrentUse is meant to be run with the race detector.
+func TestConcurrentUse(t *testing.T) {
+	rr, err := FromMap(map[string]string{"go": "went", "walk": "walked", "see": "saw"})
+	assert.Nil(t, err)
+	classes := buildRelation(t, `(<ß,ss>+[^ß])*`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr := NewTransducer(classes)
+
+			for j := 0; j < 50; j++ {
+				out, ok := rr.Transduce("walk")
+				assert.True(t, ok)
+				assert.Equal(t, []string{"walked"}, out)
+
+				buf, ok := classes.AppendTransduce(nil, "Maße")
+				assert.True(t, ok)
+				assert.Equal(t, "Masse", string(buf))
+
+				outputs, ok := tr.Transduce("Fuß")
+				assert.True(t, ok)
+				assert.Equal(t, "Fuss", string(outputs[0]))
+
+				var b bytes.Buffer
+				_, err := rr.TransduceStream(strings.NewReader("see"), &b)
+				assert.Nil(t, err)
+				assert.Equal(t, "saw", b.String())
+
+				rr.Size()
+				_, err = json.Marshal(classes)
+				assert.Nil(t, err)
+				_, err = rr.WriteTo(&b)
+				assert.Nil(t, err)
+				assert.Nil(t, classes.WriteDOT(&b, DOTOptions{ShowPairs: true}))
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,174 @@
+package relations
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pushOutputs computes for each state the longest common prefix of all
+// outputs produced on the way from it to acceptance. The prefixes are
+// refined from "unknown" until they no longer change.
+func pushOutputs(states []*sState) map[*sState][]rune {
+	prefixes := map[*sState][]rune{}
+
+	for changed := true; changed; {
+		changed = false
+
+		for _, state := range states {
+			var outputs [][]rune
+			if state.final {
+				for _, o := range state.finalOut {
+					outputs = append(outputs, []rune(o))
+				}
+			}
+			for symbol, next := range state.next {
+				if p, ok := prefixes[next]; ok {
+					out := append([]rune(state.out[symbol]), p...)
+					outputs = append(outputs, out)
+				}
+			}
+			for _, r := range state.ranges {
+				if p, ok := prefixes[r.next]; ok {
+					outputs = append(outputs, joined(template(r.out, r.identity), p))
+				}
+			}
+			if len(outputs) == 0 {
+				continue
+			}
+
+			// The symbol read on a range differs between its symbols, so
+			// the prefix stops before it.
+			prefix := commonPrefix(outputs)
+			for i, r := range prefix {
+				if r == placeholder {
+					prefix = prefix[:i]
+					break
+				}
+			}
+			if old, ok := prefixes[state]; !ok || len(prefix) != len(old) {
+				prefixes[state] = prefix
+				changed = true
+			}
+		}
+	}
+
+	return prefixes
+}
+
+// finalOutSet returns the sorted final outputs of a state without duplicates.
+func finalOutSet(finalOut []string) []string {
+	set := append([]string(nil), finalOut...)
+	sort.Strings(set)
+
+	var unique []string
+	for i, o := range set {
+		if i == 0 || o != set[i-1] {
+			unique = append(unique, o)
+		}
+	}
+	return unique
+}
+
+// Minimize replaces the transducer with the minimal equivalent one. Outputs
+// are first pushed as close to the start state as possible, after which the
+// states with equal finality, final outputs and transitions are merged.
+func (s *RegularRelation) Minimize() {
+	states := s.states()
+	prefixes := pushOutputs(states)
+
+	// trimmed removes the prefix of the given state from the output.
+	trimmed := func(state *sState, out string) string {
+		return string([]rune(out)[len(prefixes[state]):])
+	}
+
+	out := map[*sState]map[rune]string{}
+	ranges := map[*sState][]sRange{}
+	finalOut := map[*sState][]string{}
+	for _, state := range states {
+		out[state] = map[rune]string{}
+		for symbol, next := range state.next {
+			o := state.out[symbol] + string(prefixes[next])
+			out[state][symbol] = trimmed(state, o)
+		}
+		for _, r := range state.ranges {
+			t := joined(template(r.out, r.identity), prefixes[r.next])
+			trimmed := *r
+			trimmed.out, trimmed.identity = fromTemplate(t[len(prefixes[state]):])
+			ranges[state] = append(ranges[state], trimmed)
+		}
+
+		var final []string
+		for _, o := range state.finalOut {
+			final = append(final, trimmed(state, o))
+		}
+		finalOut[state] = finalOutSet(final)
+	}
+
+	// Refine the partition of states until the number of classes is stable.
+	class := map[*sState]int{}
+	for classes := 0; ; {
+		signatures := map[string]int{}
+		refined := map[*sState]int{}
+
+		for _, state := range states {
+			var b strings.Builder
+			b.WriteString(strconv.FormatBool(state.final))
+			for _, o := range finalOut[state] {
+				b.WriteString(" " + strconv.Quote(o))
+			}
+			b.WriteString(" |")
+			for _, symbol := range state.symbols() {
+				b.WriteString(" " + strconv.QuoteRune(symbol))
+				b.WriteString(":" + strconv.Quote(out[state][symbol]))
+				b.WriteString(">" + strconv.Itoa(class[state.next[symbol]]))
+			}
+			for _, r := range ranges[state] {
+				b.WriteString(" " + strconv.QuoteRune(r.lo) + "-" + strconv.QuoteRune(r.hi))
+				b.WriteString(":" + strconv.Quote(r.out) + "@" + strconv.Itoa(r.identity))
+				b.WriteString(">" + strconv.Itoa(class[r.next]))
+			}
+
+			signature := b.String()
+			if _, ok := signatures[signature]; !ok {
+				signatures[signature] = len(signatures)
+			}
+			refined[state] = signatures[signature]
+		}
+
+		class = refined
+		if len(signatures) == classes {
+			break
+		}
+		classes = len(signatures)
+	}
+
+	// Create one state per class.
+	merged := map[int]*sState{}
+	for _, state := range states {
+		if _, ok := merged[class[state]]; !ok {
+			m := newSState()
+			m.final = state.final
+			m.finalOut = finalOut[state]
+			merged[class[state]] = m
+		}
+	}
+	for _, state := range states {
+		m := merged[class[state]]
+		for symbol, next := range state.next {
+			m.next[symbol] = merged[class[next]]
+			m.out[symbol] = out[state][symbol]
+		}
+		if m.ranges != nil {
+			continue
+		}
+		for _, r := range ranges[state] {
+			r := r
+			r.next = merged[class[r.next]]
+			m.ranges = append(m.ranges, &r)
+		}
+	}
+
+	s.prefix += string(prefixes[s.start])
+	s.start = merged[class[s.start]]
+}
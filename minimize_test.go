@@ -0,0 +1,84 @@
+package relations
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinimizeDictionary(t *testing.T) {
+	rr, err := Build(strings.NewReader(
+		`<walk,walked>+<talk,talked>+<jump,jumped>+<bump,bumped>`))
+	assert.Nil(t, err)
+
+	states, transitions := rr.Size()
+	assert.Equal(t, 14, states)
+	assert.Equal(t, 16, transitions)
+
+	rr.Minimize()
+
+	states, transitions = rr.Size()
+	assert.Equal(t, 8, states)
+	assert.Equal(t, 10, transitions)
+
+	for _, word := range []string{"walk", "talk", "jump", "bump"} {
+		out, ok := rr.Transduce(word)
+		assert.True(t, ok)
+		assert.Equal(t, []string{word + "ed"}, out)
+	}
+
+	_, ok := rr.Transduce("wump")
+	assert.False(t, ok)
+}
+
+func TestMinimizePushesOutputs(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<a,xy>.(<b,z>+<c,z>)`))
+	assert.Nil(t, err)
+	rr.Minimize()
+
+	assert.Equal(t, "xyz", rr.prefix)
+	assert.Equal(t, "", rr.start.out['a'])
+
+	out, ok := rr.Transduce("ac")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"xyz"}, out)
+}
+
+func TestMinimizeMergesFinalOutputs(t *testing.T) {
+	rr, err := Build(strings.NewReader(`(<a,x>+<a,y>).<b,>*`))
+	assert.Nil(t, err)
+	rr.Minimize()
+
+	states, _ := rr.Size()
+	assert.Equal(t, 2, states)
+
+	out, ok := rr.Transduce("abb")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"x", "y"}, out)
+}
+
+func TestBuildMinimized(t *testing.T) {
+	rr, err := BuildWithOptions(context.Background(),
+		strings.NewReader(`<ab,x>+<cb,x>`), BuildOptions{Minimize: true})
+	assert.Nil(t, err)
+
+	states, transitions := rr.Size()
+	assert.Equal(t, 3, states)
+	assert.Equal(t, 3, transitions)
+}
+
+func TestMinimizeRanges(t *testing.T) {
+	rr, err := Build(strings.NewReader(`(<[a-m],x>+<[n-z],x>+[0-9])*<.,!>`))
+	assert.Nil(t, err)
+	rr.Minimize()
+
+	states, transitions := rr.Size()
+	assert.Equal(t, 2, states)
+	assert.Equal(t, 4, transitions)
+
+	out, ok := rr.Transduce("an7.")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"xx7!"}, out)
+}
@@ -1,26 +1,47 @@
 package relations
 
 import (
-	"bufio"
-	"bytes"
-	"errors"
+	"fmt"
 	"io"
+	"strconv"
+	"unicode/utf8"
 
 	"github.com/oleiade/lane"
 )
 
 // Regular expression operators.
 const (
-	union  = '+'
-	concat = '.'
-	repeat = '*'
-	end    = '!'
+	union      = '+'
+	concat     = '.'
+	repeat     = '*'
+	optional   = '?'
+	oneOrMore  = '^'
+	repetition = '{'
+	end        = '!'
 )
 
-// rule is a basic relation element in a regular expression.
+// Kinds of the tokens of definitions. Names have no character of their own,
+// so identifiers and references get negative kinds below eof that no rune
+// of the source can take.
+const (
+	identifier rune = -2 - iota
+	reference
+)
+
+// Characters of definitions, which are their own kinds.
+const (
+	define     = '='
+	terminator = ';'
+)
+
+// rule is a basic relation element in a regular expression. Rules on a
+// character class have the class number in class and no input symbol. If
+// identity is set they put out the symbol read followed by out.
 type rule struct {
-	in  rune
-	out string
+	in       rune
+	out      string
+	class    int
+	identity bool
 }
 
 // node is an element in a parse tree.
@@ -63,22 +84,35 @@ type parserMeta struct {
 	rootFirst  set
 	follow     map[int]set
 	rules      map[int]rule
+	classes    []charClass // class of rule r is classes[r.class-1]
 	finalIndex int
 }
 
 // newRuleNode creates a new leaf node that represents a <in, out> pair.
 func (m *parserMeta) newRuleNode(in rune, out string) *ruleNode {
+	return m.newLeaf(rule{in: in, out: out})
+}
+
+// newClassNode creates a new leaf node that maps each symbol of the class to
+// out, preceded by the symbol itself if identity is set.
+func (m *parserMeta) newClassNode(class charClass, out string, identity bool) *ruleNode {
+	m.classes = append(m.classes, class)
+	return m.newLeaf(rule{out: out, class: len(m.classes), identity: identity})
+}
+
+// newLeaf creates a new leaf node for the rule.
+func (m *parserMeta) newLeaf(r rule) *ruleNode {
 	// Unique index for each rule.
 	m.finalIndex++
 
-	m.rules[m.finalIndex] = rule{in, out}
+	m.rules[m.finalIndex] = r
 	node := &ruleNode{
 		baseNode{first: newSet(m.finalIndex), last: newSet(m.finalIndex)},
 		m.finalIndex,
 	}
 
 	// Mark if language of the new node accepts empty string.
-	node.nullable = (in == 0 && out == "")
+	node.nullable = (r.in == 0 && r.class == 0 && r.out == "")
 
 	return node
 }
@@ -92,15 +126,15 @@ func (m *parserMeta) newOperatorNode(operator rune, left, right node) *operatorN
 
 	leftBase := node.left.base()
 
-	// node.right is nil for unary operators (only `*` for now).
+	// node.right is nil for unary operators.
 	var rightBase *baseNode
 	if node.right != nil {
 		rightBase = node.right.base()
 	}
 
 	switch node.kind {
-	case repeat:
-		node.nullable = true
+	case repeat, oneOrMore:
+		node.nullable = node.kind == repeat || leftBase.nullable
 
 		node.first = leftBase.first.clone()
 		node.last = leftBase.last.clone()
@@ -108,6 +142,11 @@ func (m *parserMeta) newOperatorNode(operator rune, left, right node) *operatorN
 		for position := range node.last {
 			m.follow[position] = node.first.union(m.follow[position])
 		}
+	case optional:
+		node.nullable = true
+
+		node.first = leftBase.first.clone()
+		node.last = leftBase.last.clone()
 	case union:
 		node.nullable = rightBase.nullable || leftBase.nullable
 
@@ -135,101 +174,418 @@ func (m *parserMeta) newOperatorNode(operator rune, left, right node) *operatorN
 	return node
 }
 
-// computeParserMeta builds parse tree from regular expression while computing
-// nullable, firstPos, lastPos and followPos.
-func computeParserMeta(source io.Reader) (*parserMeta, error) {
-	meta := &parserMeta{follow: map[int]set{}, rules: map[int]rule{}}
+// node creates the parse tree of the expression. Every call gives the rules
+// fresh positions, numbered from left to right.
+func (m *parserMeta) node(e *Expr) node {
+	switch e.kind {
+	case PairExpr:
+		in := []rune(e.in)
+		if len(in) == 0 {
+			return m.newRuleNode(epsilon, e.out)
+		}
+
+		// The first rune of the input gets all symbols of the output and
+		// the rest of the input is concatenated to it.
+		var left node = m.newRuleNode(in[0], e.out)
+		for _, c := range in[1:] {
+			left = m.newOperatorNode(concat, left, m.newRuleNode(c, ""))
+		}
+		return left
+
+	case ClassExpr:
+		return m.newClassNode(e.class, e.out, e.identity)
+
+	case UnionExpr, ConcatExpr:
+		left := m.node(e.operands[0])
+		right := m.node(e.operands[1])
+		return m.newOperatorNode(exprOperators[e.kind], left, right)
+
+	case RepeatExpr:
+		return m.newRepetitionNode(e.operands[0], e.min, e.max)
+	}
+
+	return m.newOperatorNode(exprOperators[e.kind], m.node(e.operands[0]), nil)
+}
+
+// newRepetitionNode expands the operand repeated from min to max times into
+// the concatenation of its copies. Negative max means no upper bound.
+func (m *parserMeta) newRepetitionNode(operand *Expr, min, max int) node {
+	var result node
+	add := func(n node) {
+		if result == nil {
+			result = n
+		} else {
+			result = m.newOperatorNode(concat, result, n)
+		}
+	}
+
+	for i := 0; i < min; i++ {
+		add(m.node(operand))
+	}
+	if max < 0 {
+		add(m.newOperatorNode(repeat, m.node(operand), nil))
+	}
+	for i := min; i < max; i++ {
+		add(m.newOperatorNode(optional, m.node(operand), nil))
+	}
+
+	return result
+}
+
+// SyntaxError reports a malformed regular expression.
+type SyntaxError struct {
+	Offset   int    // byte offset of the offending token
+	Line     int    // line of the offending token, starting from 1
+	Column   int    // column of the offending token, starting from 1
+	Token    string // offending token, empty at the end of the input
+	Expected string // description of what was expected instead
+}
+
+func (e *SyntaxError) Error() string {
+	found := "end of input"
+	if e.Token != "" {
+		found = strconv.Quote(e.Token)
+	}
+	return fmt.Sprintf("syntax error at %d:%d: unexpected %s, %s",
+		e.Line, e.Column, found, e.Expected)
+}
+
+// newSyntaxError creates a SyntaxError for the given token.
+func newSyntaxError(t token, expected string) *SyntaxError {
+	return &SyntaxError{
+		Offset:   t.pos.offset,
+		Line:     t.pos.line,
+		Column:   t.pos.column,
+		Token:    t.text,
+		Expected: expected,
+	}
+}
+
+// precedence of the binary operators. Postfix operators are applied as soon
+// as they are read, so they bind tighter than both.
+var precedence = map[rune]int{
+	union:  1,
+	concat: 2,
+}
+
+// parser holds the state of the operator precedence parsing of a regular
+// expression.
+type parser struct {
+	lexer     *lexer
+	exprs     *lane.Stack
+	operators *lane.Stack // tokens of pending operators and parentheses
+
+	// Tokens to parse before reading further from the lexer, such as those
+	// of an expanded reference.
+	queue []token
+
+	// expanded counts the tokens queued by expanding references, which is
+	// limited to maxExpansion.
+	expanded int
 
-	nodes := lane.NewStack()
-	operators := lane.NewStack()
+	definitions map[string]*definition
+	order       []*definition // definitions in the order they appear
 
-	reader := bufio.NewReader(source)
+	// checking is set while a definition is parsed on its own, which
+	// leaves the references in it unexpanded.
+	checking bool
+}
+
+func newParser(source io.Reader) *parser {
+	return &parser{
+		lexer:       newLexer(source),
+		exprs:       lane.NewStack(),
+		operators:   lane.NewStack(),
+		definitions: map[string]*definition{},
+	}
+}
+
+func newParserMeta() *parserMeta {
+	return &parserMeta{follow: map[int]set{}, rules: map[int]rule{}}
+}
+
+// next returns the next token to parse.
+func (p *parser) next() (token, error) {
+	if len(p.queue) != 0 {
+		t := p.queue[0]
+		p.queue = p.queue[1:]
+		return t, nil
+	}
+	return p.lexer.next()
+}
+
+// Kinds of the expressions created by operator tokens.
+var operatorExprs = map[rune]ExprKind{
+	union:      UnionExpr,
+	concat:     ConcatExpr,
+	repeat:     StarExpr,
+	optional:   OptionalExpr,
+	oneOrMore:  OneOrMoreExpr,
+	repetition: RepeatExpr,
+}
+
+// reduce pops the operands of the operator token t from the exprs stack and
+// pushes the resulting expression back.
+func (p *parser) reduce(t token) error {
+	operands := make([]*Expr, 2)
+	for i := 1; i >= 0; i-- {
+		if p.exprs.Empty() {
+			return newSyntaxError(t,
+				fmt.Sprintf("expected operand for '%c'", t.kind))
+		}
+		operands[i] = p.exprs.Pop().(*Expr)
+	}
+
+	p.exprs.Push(&Expr{
+		kind:     operatorExprs[t.kind],
+		operands: operands,
+		pos:      operands[0].pos,
+	})
+	return nil
+}
 
+// maxRepeated is the largest number of symbols that a counted repetition may
+// expand to. The counts of nested repetitions multiply, so limiting each of
+// them to maxRepetition alone would not bound the size of the expansion.
+const maxRepeated = 1 << 16
+
+// repeated returns the number of symbols of the expression once its counted
+// repetitions are expanded into copies of their operands. Each rune of the
+// input of a pair is a symbol, as are classes and pairs with empty input.
+func repeated(e *Expr) int {
+	switch e.kind {
+	case PairExpr:
+		if n := utf8.RuneCountInString(e.in); n > 1 {
+			return n
+		}
+		return 1
+	case ClassExpr:
+		return 1
+	case RepeatExpr:
+		copies := e.max
+		if copies < 0 {
+			copies = e.min + 1
+		}
+		return repeated(e.operands[0]) * copies
+	}
+
+	n := 0
+	for _, o := range e.operands {
+		n += repeated(o)
+	}
+	return n
+}
+
+// postfix applies the postfix operator token t to the expression on top of
+// the exprs stack. Counted repetitions that expand to more than maxRepeated
+// symbols are reported as a *SyntaxError.
+func (p *parser) postfix(t token) error {
+	operand := p.exprs.Pop().(*Expr)
+	e := &Expr{
+		kind:     operatorExprs[t.kind],
+		min:      t.min,
+		max:      t.max,
+		operands: []*Expr{operand},
+		pos:      operand.pos,
+	}
+	if t.kind == repetition && repeated(e) > maxRepeated {
+		return newSyntaxError(t, fmt.Sprintf(
+			"expected the repetition to expand to at most %d symbols", maxRepeated))
+	}
+
+	p.exprs.Push(e)
+	return nil
+}
+
+// pair adds the <in, out> pair token t to the exprs stack.
+func (p *parser) pair(t token) {
+	e := &Expr{kind: PairExpr, in: t.in, out: t.out, pos: t.pos}
+	if t.class != nil {
+		e = &Expr{
+			kind:     ClassExpr,
+			class:    t.class,
+			identity: t.identity,
+			out:      t.out,
+			pos:      t.pos,
+		}
+	}
+
+	p.exprs.Push(e)
+}
+
+// expectedOperand describes the missing operand after the token prev.
+func expectedOperand(prev token) string {
+	if prev.kind == eof {
+		return "expected expression"
+	}
+	return fmt.Sprintf("expected operand after '%c'", prev.kind)
+}
+
+// parse consumes the definitions and the main expression following them and
+// leaves the expression tree of the latter on the exprs stack.
+func (p *parser) parse() error {
 	for {
-		char, _, err := reader.ReadRune()
-		if err == io.EOF {
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+
+		if t.kind != identifier {
+			p.queue = append(p.queue, t)
 			break
-		} else if err != nil {
-			return nil, err
 		}
+		if err := p.definition(t); err != nil {
+			return err
+		}
+	}
 
-		switch char {
-		case '<':
-			in := &bytes.Buffer{}
-			out := &bytes.Buffer{}
+	if err := p.checkDefinitions(); err != nil {
+		return err
+	}
+	return p.expression()
+}
 
-			// Consume the whole <in, out> pair.
-			for {
-				char, _, err = reader.ReadRune()
-				if err != nil {
-					return nil, errors.New("Incorrect input")
-				}
+// expression consumes the tokens up to the end of the input and leaves the
+// expression tree on the exprs stack.
+func (p *parser) expression() error {
+	// expectOperand is true when the next token has to start an operand.
+	expectOperand := true
+	prev := token{kind: eof}
 
-				if char == ',' {
-					in = out
-					out = &bytes.Buffer{}
-					continue
-				} else if char == '>' {
-					break
-				}
+	for {
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
 
-				out.WriteRune(char)
+		switch t.kind {
+		case '<', '(':
+			if !expectOperand {
+				return newSyntaxError(t,
+					fmt.Sprintf("expected operator before '%c'", t.kind))
 			}
 
-			// Add first rune from the input tape with all symbols from
-			// the output tape.
-			first, _, _ := in.ReadRune()
-			nodes.Push(meta.newRuleNode(first, out.String()))
+			if t.kind == '<' {
+				p.pair(t)
+				expectOperand = false
+			} else {
+				p.operators.Push(t)
+			}
 
-			// Add the rest of the input tape to the parse tree with
-			// concatenation operator.
-			for {
-				c, _, err := in.ReadRune()
-				if err == io.EOF {
+		case reference:
+			if !expectOperand {
+				return newSyntaxError(t, "expected operator before reference")
+			}
+			if err := p.expand(t); err != nil {
+				return err
+			}
+			if p.checking {
+				expectOperand = false
+			}
+
+		case union, concat:
+			if expectOperand {
+				return newSyntaxError(t, expectedOperand(prev))
+			}
+
+			// Reduce the pending operators that bind at least as tightly,
+			// which makes the operators left associative.
+			for !p.operators.Empty() {
+				top := p.operators.Head().(token)
+				if top.kind == '(' || precedence[top.kind] < precedence[t.kind] {
 					break
 				}
 
-				right := meta.newRuleNode(c, "")
-				left := nodes.Pop().(node)
-				nodes.Push(meta.newOperatorNode(concat, left, right))
+				p.operators.Pop()
+				if err := p.reduce(top); err != nil {
+					return err
+				}
 			}
 
-		case '(', union, concat:
-			operators.Push(char)
+			p.operators.Push(t)
+			expectOperand = true
 
 		case ')':
+			if expectOperand {
+				return newSyntaxError(t, expectedOperand(prev))
+			}
+
 			for {
-				operator := operators.Pop().(rune)
-				if operator == '(' {
+				if p.operators.Empty() {
+					return newSyntaxError(t, "unbalanced ')'")
+				}
+
+				operator := p.operators.Pop().(token)
+				if operator.kind == '(' {
+					// The group starts at the parenthesis.
+					grouped := *p.exprs.Pop().(*Expr)
+					grouped.pos = operator.pos
+					p.exprs.Push(&grouped)
 					break
 				}
+				if err := p.reduce(operator); err != nil {
+					return err
+				}
+			}
+
+		case repeat, optional, oneOrMore, repetition:
+			if expectOperand {
+				return newSyntaxError(t, expectedOperand(prev))
+			}
+			if err := p.postfix(t); err != nil {
+				return err
+			}
+
+		case eof:
+			if expectOperand {
+				return newSyntaxError(t, expectedOperand(prev))
+			}
 
-				right := nodes.Pop().(node)
-				left := nodes.Pop().(node)
-				nodes.Push(meta.newOperatorNode(operator, left, right))
+			// Consume everything from the operator and exprs stacks.
+			for !p.operators.Empty() {
+				operator := p.operators.Pop().(token)
+				if operator.kind == '(' {
+					return newSyntaxError(operator, "unbalanced '('")
+				}
+				if err := p.reduce(operator); err != nil {
+					return err
+				}
 			}
 
-		case repeat:
-			operand := nodes.Pop().(node)
-			nodes.Push(meta.newOperatorNode(char, operand, nil))
+			return nil
+
+		default:
+			if expectOperand {
+				return newSyntaxError(t, expectedOperand(prev))
+			}
+			return newSyntaxError(t, "expected operator")
 		}
-	}
 
-	// Consume everything from the operator and nodes stacks.
-	for !operators.Empty() {
-		operator := operators.Pop().(rune)
+		prev = t
+	}
+}
 
-		right := nodes.Pop().(node)
-		left := nodes.Pop().(node)
-		nodes.Push(meta.newOperatorNode(operator, left, right))
+// computeParserMeta builds parse tree from regular expression while computing
+// nullable, firstPos, lastPos and followPos.
+func computeParserMeta(source io.Reader) (*parserMeta, error) {
+	e, err := Parse(source)
+	if err != nil {
+		return nil, err
 	}
+	return exprParserMeta(e), nil
+}
+
+// exprParserMeta builds the parse tree of the expression while computing
+// nullable, firstPos, lastPos and followPos.
+func exprParserMeta(e *Expr) *parserMeta {
+	meta := newParserMeta()
 
 	// Add endmarker character.
+	left := meta.node(e)
 	right := meta.newRuleNode(end, "")
-	left := nodes.Pop().(node)
 	root := meta.newOperatorNode(concat, left, right)
 
 	meta.rootFirst = root.first
 
-	return meta, nil
+	return meta
 }
@@ -1,6 +1,7 @@
 package relations
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -70,3 +71,229 @@ func TestMulticharRootFirst(t *testing.T) {
 		assert.True(t, meta.rootFirst.equal(newSet(1, 4)))
 	})
 }
+
+func testSyntaxError(t *testing.T, regexp string, expected *SyntaxError) {
+	_, err := computeParserMeta(strings.NewReader(regexp))
+
+	syntaxErr, ok := err.(*SyntaxError)
+	if assert.True(t, ok, "expected *SyntaxError for %q, got %v", regexp, err) {
+		assert.Equal(t, expected, syntaxErr)
+	}
+}
+
+func TestDanglingOperator(t *testing.T) {
+	testSyntaxError(t, `<a,b>+`, &SyntaxError{
+		Offset: 6, Line: 1, Column: 7,
+		Expected: "expected operand after '+'",
+	})
+	testSyntaxError(t, `<a,b>.*`, &SyntaxError{
+		Offset: 6, Line: 1, Column: 7, Token: `*`,
+		Expected: "expected operand after '.'",
+	})
+	testSyntaxError(t, `+<a,b>`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: `+`,
+		Expected: "expected expression",
+	})
+}
+
+func TestUnbalancedParentheses(t *testing.T) {
+	testSyntaxError(t, `(<a,b>`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: `(`,
+		Expected: "unbalanced '('",
+	})
+	testSyntaxError(t, `<a,b>)`, &SyntaxError{
+		Offset: 5, Line: 1, Column: 6, Token: `)`,
+		Expected: "unbalanced ')'",
+	})
+	testSyntaxError(t, `(<a,b>+)`, &SyntaxError{
+		Offset: 7, Line: 1, Column: 8, Token: `)`,
+		Expected: "expected operand after '+'",
+	})
+}
+
+func TestUnterminatedPair(t *testing.T) {
+	testSyntaxError(t, "<a,b>+\n<cd,e", &SyntaxError{
+		Offset: 7, Line: 2, Column: 1, Token: `<cd,e`,
+		Expected: "expected '>' to close the pair",
+	})
+}
+
+func TestEmptyExpression(t *testing.T) {
+	testSyntaxError(t, ``, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1,
+		Expected: "expected expression",
+	})
+}
+
+func TestSyntaxErrorMessage(t *testing.T) {
+	_, err := computeParserMeta(strings.NewReader("<a,b>+\n  (<c,d>"))
+	assert.EqualError(t, err,
+		`syntax error at 2:3: unexpected "(", unbalanced '('`)
+}
+
+// parseTree returns the parse tree of the regular expression in prefix
+// notation, showing rules by their input.
+func parseTree(t *testing.T, regexp string) string {
+	e, err := Parse(strings.NewReader(regexp))
+	if !assert.Nil(t, err) {
+		return ""
+	}
+	meta := newParserMeta()
+
+	var format func(n node) string
+	format = func(n node) string {
+		switch n := n.(type) {
+		case *ruleNode:
+			return string(meta.rules[n.index].in)
+		case *operatorNode:
+			if n.right == nil {
+				return fmt.Sprintf("(%c %s)", n.kind, format(n.left))
+			}
+			return fmt.Sprintf("(%c %s %s)", n.kind, format(n.left), format(n.right))
+		}
+		return "?"
+	}
+
+	return format(meta.node(e))
+}
+
+func TestPrecedence(t *testing.T) {
+	assert.Equal(t, "(+ a (. b c))", parseTree(t, `<a,x>+<b,y>.<c,z>`))
+	assert.Equal(t, "(+ (. a b) c)", parseTree(t, `<a,x>.<b,y>+<c,z>`))
+	assert.Equal(t, "(+ a (. b (* c)))", parseTree(t, `<a,>+<b,>.<c,>*`))
+	assert.Equal(t, "(. (* (+ a b)) c)", parseTree(t, `(<a,>+<b,>)*.<c,>`))
+	assert.Equal(t, "(+ (. a (* b)) (. (* c) d))",
+		parseTree(t, `<a,>.<b,>*+<c,>*.<d,>`))
+}
+
+func TestLeftAssociativity(t *testing.T) {
+	assert.Equal(t, "(+ (+ a b) c)", parseTree(t, `<a,>+<b,>+<c,>`))
+	assert.Equal(t, "(. (. a b) c)", parseTree(t, `<a,>.<b,>.<c,>`))
+	assert.Equal(t, "(+ (+ a (. (. b c) d)) e)",
+		parseTree(t, `<a,>+<b,>.<c,>.<d,>+<e,>`))
+}
+
+func TestParenthesesOverridePrecedence(t *testing.T) {
+	assert.Equal(t, "(. (+ a b) c)", parseTree(t, `(<a,>+<b,>).<c,>`))
+	assert.Equal(t, "(+ a (+ b c))", parseTree(t, `<a,>+(<b,>+<c,>)`))
+}
+
+func TestMulticharPairTree(t *testing.T) {
+	assert.Equal(t, "(+ (. (. a b) c) d)", parseTree(t, `<abc,>+<d,>`))
+}
+
+func TestImplicitConcatenation(t *testing.T) {
+	assert.Equal(t, "(. a b)", parseTree(t, `<a,><b,>`))
+	assert.Equal(t, "(. (. a b) (+ c d))", parseTree(t, `<a,><b,>(<c,>+<d,>)`))
+	assert.Equal(t, "(+ (. a (* b)) (. (* c) d))", parseTree(t, `<a,><b,>*+<c,>*<d,>`))
+	assert.Equal(t, "(. (* (+ a b)) (+ c d))", parseTree(t, `(<a,>+<b,>)*(<c,>+<d,>)`))
+}
+
+func TestImplicitAndExplicitConcatenation(t *testing.T) {
+	assert.Equal(t, parseTree(t, `<un,UN>.<do,DO>.(<ing,ING>+<,>)`),
+		parseTree(t, `<un,UN><do,DO>(<ing,ING>+<,>)`))
+}
+
+func TestOptionalFollow(t *testing.T) {
+	testParserMetadata(`<a,>?<b,>`, func(meta *parserMeta) {
+		assert.True(t, meta.rootFirst.equal(newSet(1, 2)))
+		assert.True(t, meta.follow[1].equal(newSet(2)))
+		assert.True(t, meta.follow[2].equal(newSet(3)))
+	})
+}
+
+func TestOneOrMoreFollow(t *testing.T) {
+	testParserMetadata(`<a,>^<b,>`, func(meta *parserMeta) {
+		assert.True(t, meta.rootFirst.equal(newSet(1)))
+		assert.True(t, meta.follow[1].equal(newSet(1, 2)))
+		assert.True(t, meta.follow[2].equal(newSet(3)))
+	})
+}
+
+func TestCountedRepetitionPositions(t *testing.T) {
+	testParserMetadata(`<ab,x>{2,3}`, func(meta *parserMeta) {
+		assert.Equal(t, 7, meta.finalIndex)
+		assert.True(t, meta.rules[3].contain('a', "x"))
+		assert.True(t, meta.rules[5].contain('a', "x"))
+
+		assert.True(t, meta.rootFirst.equal(newSet(1)))
+		assert.True(t, meta.follow[2].equal(newSet(3)))
+		assert.True(t, meta.follow[4].equal(newSet(5, 7)))
+		assert.True(t, meta.follow[6].equal(newSet(7)))
+	})
+}
+
+func TestUnboundedRepetitionPositions(t *testing.T) {
+	testParserMetadata(`<a,>{1,}`, func(meta *parserMeta) {
+		assert.True(t, meta.follow[1].equal(newSet(2, 3)))
+		assert.True(t, meta.follow[2].equal(newSet(2, 3)))
+	})
+}
+
+func TestQuantifierTree(t *testing.T) {
+	assert.Equal(t, "(+ a (. b (? c)))", parseTree(t, `<a,>+<b,><c,>?`))
+	assert.Equal(t, "(. (^ (+ a b)) c)", parseTree(t, `(<a,>+<b,>)^<c,>`))
+	assert.Equal(t, "(. (. a a) (? a))", parseTree(t, `<a,>{2,3}`))
+	assert.Equal(t, "(. a (* a))", parseTree(t, `<a,>{1,}`))
+	assert.Equal(t, "(. (? a) (? a))", parseTree(t, `<a,>{,2}`))
+	assert.Equal(t, "(? (* a))", parseTree(t, `<a,>*?`))
+}
+
+func TestQuantifierErrors(t *testing.T) {
+	testSyntaxError(t, `?<a,b>`, &SyntaxError{
+		Offset: 0, Line: 1, Column: 1, Token: `?`,
+		Expected: "expected expression",
+	})
+	testSyntaxError(t, `<a,b>+{2}`, &SyntaxError{
+		Offset: 6, Line: 1, Column: 7, Token: `{2}`,
+		Expected: "expected operand after '+'",
+	})
+	testSyntaxError(t, `<a,b>{3,2}`, &SyntaxError{
+		Offset: 5, Line: 1, Column: 6, Token: `{3,2}`,
+		Expected: "expected the minimum not to exceed the maximum",
+	})
+	testSyntaxError(t, `<a,b>{0}`, &SyntaxError{
+		Offset: 5, Line: 1, Column: 6, Token: `{0}`,
+		Expected: "expected a positive maximum count",
+	})
+	testSyntaxError(t, `<a,b>{}`, &SyntaxError{
+		Offset: 5, Line: 1, Column: 6, Token: `{}`,
+		Expected: "expected a count",
+	})
+	testSyntaxError(t, `<a,b>{1,x}`, &SyntaxError{
+		Offset: 5, Line: 1, Column: 6, Token: `{1,x`,
+		Expected: "expected a count",
+	})
+	testSyntaxError(t, `<a,b>{999999999}`, &SyntaxError{
+		Offset: 6, Line: 1, Column: 7, Token: `999999999`,
+		Expected: "expected a count of at most 1000",
+	})
+	testSyntaxError(t, `<a,b>{10,1001}`, &SyntaxError{
+		Offset: 9, Line: 1, Column: 10, Token: `1001`,
+		Expected: "expected a count of at most 1000",
+	})
+	testSyntaxError(t, `<a,b>{99999999999999999999,}`, &SyntaxError{
+		Offset: 6, Line: 1, Column: 7, Token: `99999999999999999999`,
+		Expected: "expected a count of at most 1000",
+	})
+	_, err := Parse(strings.NewReader(`<a,b>{1000}`))
+	assert.Nil(t, err)
+}
+
+func TestNestedRepetitionLimit(t *testing.T) {
+	testSyntaxError(t, `(<a,b>{1000}){1000}`, &SyntaxError{
+		Offset: 13, Line: 1, Column: 14, Token: `{1000}`,
+		Expected: "expected the repetition to expand to at most 65536 symbols",
+	})
+	testSyntaxError(t, `A=<a,b>{1000};{A}{1000}`, &SyntaxError{
+		Offset: 17, Line: 1, Column: 18, Token: `{1000}`,
+		Expected: "expected the repetition to expand to at most 65536 symbols",
+	})
+	testSyntaxError(t, `<abc,x>{100,}{300}`, &SyntaxError{
+		Offset: 13, Line: 1, Column: 14, Token: `{300}`,
+		Expected: "expected the repetition to expand to at most 65536 symbols",
+	})
+
+	_, err := Parse(strings.NewReader(`((<ab,x>{8}){64}){64}`))
+	assert.Nil(t, err)
+}
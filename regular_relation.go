@@ -1,9 +1,12 @@
 package relations
 
 import (
-	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"sort"
+	"unicode/utf8"
 
 	"github.com/oleiade/lane"
 	"github.com/s2gatev/hcache"
@@ -44,11 +47,23 @@ func (ps pairs) Swap(i, j int) {
 	ps[i], ps[j] = ps[j], ps[i]
 }
 
-// sState is a state in a subsequential transducer.
+// sRange is a transition of a subsequential transducer on the symbols from
+// lo to hi. Its output is out with the symbol read inserted at the byte
+// offset identity, unless identity is negative.
+type sRange struct {
+	lo, hi   rune
+	next     *sState
+	out      string
+	identity int
+}
+
+// sState is a state in a subsequential transducer. The ranges are sorted and
+// contain none of the symbols in next.
 type sState struct {
 	remainingPairs pairs
 	next           map[rune]*sState
 	out            map[rune]string
+	ranges         []*sRange
 	final          bool
 	finalOut       []string
 	isVisited      bool
@@ -63,80 +78,453 @@ func (ss *sState) getFinalOut() []string {
 	var finalRemaining []string
 	for _, p := range ss.remainingPairs {
 		p := p.(*pair)
-		if p.state.final {
+		if !p.state.final {
+			continue
+		}
+
+		if len(p.state.finalOut) == 0 {
 			finalRemaining = append(finalRemaining, p.remaining)
 		}
+		for _, o := range p.state.finalOut {
+			finalRemaining = append(finalRemaining, p.remaining+o)
+		}
 	}
 	return finalRemaining
 }
 
+// step returns the state reached from this one with the given input symbol
+// and the output of the transition.
+func (ss *sState) step(symbol rune) (*sState, string, bool) {
+	if next, ok := ss.next[symbol]; ok {
+		return next, ss.out[symbol], true
+	}
+
+	r := ss.rangeOf(symbol)
+	if r == nil {
+		return nil, "", false
+	}
+	return r.next, fill(r.out, r.identity, symbol), true
+}
+
+// rangeOf returns the range transition on the symbol, or nil if there is
+// none.
+func (ss *sState) rangeOf(symbol rune) *sRange {
+	i := sort.Search(len(ss.ranges), func(i int) bool {
+		return ss.ranges[i].hi >= symbol
+	})
+	if i == len(ss.ranges) || ss.ranges[i].lo > symbol {
+		return nil
+	}
+	return ss.ranges[i]
+}
+
+// appendStep is like step but appends the output of the transition to dst
+// instead of returning it.
+func (ss *sState) appendStep(dst []byte, symbol rune) (*sState, []byte, bool) {
+	if next, ok := ss.next[symbol]; ok {
+		return next, append(dst, ss.out[symbol]...), true
+	}
+
+	r := ss.rangeOf(symbol)
+	if r == nil {
+		return nil, dst, false
+	}
+	if r.identity < 0 {
+		return r.next, append(dst, r.out...), true
+	}
+	dst = append(dst, r.out[:r.identity]...)
+	dst = utf8.AppendRune(dst, symbol)
+	return r.next, append(dst, r.out[r.identity:]...), true
+}
+
+// walk returns the state reached from this one with the given input and the
+// output produced on the way.
+func (ss *sState) walk(input string) (*sState, string, bool) {
+	node := ss
+	var output string
+
+	for _, symbol := range input {
+		next, out, ok := node.step(symbol)
+		if !ok {
+			return nil, "", false
+		}
+		output += out
+		node = next
+	}
+
+	return node, output, true
+}
+
+// symbols returns the input symbols of the transitions of the state in
+// increasing order.
+func (ss *sState) symbols() []rune {
+	symbols := make([]rune, 0, len(ss.next))
+	for symbol := range ss.next {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+	return symbols
+}
+
 // lcp calculates the longest common prefix of the input strings.
 func lcp(strs [][]rune) string {
+	return string(commonPrefix(strs))
+}
+
+// commonPrefix returns the longest common prefix of the rune slices.
+func commonPrefix(strs [][]rune) []rune {
 	if len(strs) == 0 {
-		return ""
+		return nil
 	}
 
 	for i, c := range strs[0] {
 		for _, s := range strs[1:] {
 			if i == len(s) || s[i] != c {
-				return string(strs[0][:i])
+				return strs[0][:i]
 			}
 		}
 	}
-	return string(strs[0])
+	return strs[0]
+}
+
+// joined returns a new slice with the runes of a followed by those of b.
+func joined(a, b []rune) []rune {
+	return append(append(make([]rune, 0, len(a)+len(b)), a...), b...)
 }
 
 // RegularRelation is a struct containing the initial state of the
-// subsequential transducer that recognizes the input regular relation.
+// subsequential transducer that recognizes the input regular relation and
+// the output emitted before reading any input.
+//
+// A RegularRelation is not modified after it is constructed, except by
+// Minimize and UnmarshalJSON, so all other methods may be called
+// concurrently from any number of goroutines.
 type RegularRelation struct {
-	start *sState
+	start  *sState
+	prefix string
 }
 
-// Transduce feeds the input string into the RegularRelation transducer
-// and returns all possible results from the output transducer tape.
-func (s *RegularRelation) Transduce(input string) ([]string, bool) {
-	node := s.start
-	var output string
+// states returns the states reachable from the start state in breadth-first
+// order, following transitions in increasing order of their input symbols.
+func (s *RegularRelation) states() []*sState {
+	states := []*sState{s.start}
+	seen := map[*sState]bool{s.start: true}
+
+	for i := 0; i < len(states); i++ {
+		state := states[i]
+		var targets []*sState
+		for _, symbol := range state.symbols() {
+			targets = append(targets, state.next[symbol])
+		}
+		for _, r := range state.ranges {
+			targets = append(targets, r.next)
+		}
 
-	for _, symbol := range input {
-		nextnode, ok := node.next[symbol]
-		if !ok {
-			return nil, false
+		for _, next := range targets {
+			if !seen[next] {
+				seen[next] = true
+				states = append(states, next)
+			}
 		}
-		output += node.out[symbol]
-		node = nextnode
 	}
 
-	if !node.final {
+	return states
+}
+
+// Size returns the number of states and transitions of the transducer.
+func (s *RegularRelation) Size() (states, transitions int) {
+	for _, state := range s.states() {
+		states++
+		transitions += len(state.next) + len(state.ranges)
+	}
+	return states, transitions
+}
+
+// Transduce feeds the input string into the RegularRelation transducer
+// and returns all possible results from the output transducer tape.
+func (s *RegularRelation) Transduce(input string) ([]string, bool) {
+	var buf [64]byte
+	node, output, ok := s.appendWalk(buf[:0], input)
+	if !ok || !node.final {
 		return nil, false
 	}
 
 	var result []string
-	for _, o := range node.finalOut {
-		result = append(result, output+o)
+	if len(node.finalOut) != 0 {
+		result = make([]string, len(node.finalOut))
+	}
+	for i, o := range node.finalOut {
+		result[i] = string(output) + o
 	}
 
 	return result, true
 }
 
+// appendWalk appends the prefix and the output produced on the way from the
+// start state with the input to dst and returns the state reached.
+func (s *RegularRelation) appendWalk(dst []byte, input string) (*sState, []byte, bool) {
+	node := s.start
+	dst = append(dst, s.prefix...)
+
+	for _, symbol := range input {
+		var ok bool
+		if node, dst, ok = node.appendStep(dst, symbol); !ok {
+			return nil, dst, false
+		}
+	}
+
+	return node, dst, true
+}
+
+// ErrNotSubsequential is reported when the regular relation is not a
+// (p-)subsequential function and so has no subsequential transducer.
+var ErrNotSubsequential = errors.New("relation is not a subsequential function")
+
+// NotSubsequentialError names two paths of the transducer over the same input
+// whose outputs drift apart without bound. Such paths violate the twins
+// property, which holds for every (p-)subsequential function.
+type NotSubsequentialError struct {
+	Input   string
+	Outputs [2]string
+}
+
+func (e *NotSubsequentialError) Error() string {
+	return fmt.Sprintf("%v: outputs %q and %q for input %q diverge without bound",
+		ErrNotSubsequential, e.Outputs[0], e.Outputs[1], e.Input)
+}
+
+// Unwrap makes the error match ErrNotSubsequential.
+func (e *NotSubsequentialError) Unwrap() error {
+	return ErrNotSubsequential
+}
+
+// maxSplit is the largest number of symbols of character classes that a
+// state of the subsequential transducer has separate transitions for.
+const maxSplit = 4096
+
+// ErrWideClass is reported when a character class of more than 4096 symbols
+// would have to be expanded into one transition per symbol. That happens
+// when the output delayed after reading a symbol of the class contains the
+// symbol, which then needs a separate state for each symbol, and when a
+// class with constant output is inverted.
+var ErrWideClass = errors.New("delayed output depends on the symbol of a wide character class")
+
+// Errors reported by BuildWithOptions when a limit is exceeded.
+var (
+	ErrStateLimit = errors.New("state limit exceeded")
+	ErrDelayLimit = errors.New("delayed output limit exceeded")
+)
+
+// BuildOptions limits the resources used by BuildWithOptions.
+type BuildOptions struct {
+	// MaxStates is the maximum number of states of the subsequential
+	// transducer, and of the non-deterministic transducer of the positions
+	// of the expression that it is built from. Zero means no limit.
+	MaxStates int
+
+	// MaxDelay is the maximum length in runes of the output delayed in any
+	// state of the subsequential transducer. Zero means no limit.
+	MaxDelay int
+
+	// Minimize the constructed transducer.
+	Minimize bool
+}
+
+// BuildError reports an interrupted construction of a RegularRelation and how
+// far it got. Err is ErrStateLimit, ErrDelayLimit or the error of the context.
+// The counts are those of the transducer being built when it stopped, the
+// non-deterministic one of the expression or the subsequential one.
+type BuildError struct {
+	States  int // number of states created so far
+	Pending int // number of states waiting to be processed
+	Err     error
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("construction stopped after %d states (%d pending): %v",
+		e.States, e.Pending, e.Err)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
 // Build builds a RegularRelation subsequential transducer from the
 // input regular relation expression.
-// NOTE: All operations must be explicitly written in the regular expression.
+// Concatenation is written either with `.` or by juxtaposing the operands.
+// Character classes such as `[a-z]`, `[^0-9]` or `\p{L}` map each of their
+// symbols to itself, and `<[a-z],x>` maps each of them to x.
+// The expression may be preceded by definitions `Name = expression;` that
+// are referred to as `{Name}`.
 func Build(source io.Reader) (*RegularRelation, error) {
-	tr, err := newTransducer(source)
+	return BuildWithOptions(context.Background(), source, BuildOptions{})
+}
+
+// BuildWithOptions is like Build but stops with a *BuildError when the context
+// is done or the construction exceeds the limits in opts.
+func BuildWithOptions(ctx context.Context, source io.Reader,
+	opts BuildOptions) (*RegularRelation, error) {
+
+	e, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return BuildExpr(ctx, e, opts)
+}
+
+// BuildExpr is like BuildWithOptions but builds the RegularRelation from an
+// expression that has already been parsed. ErrNullSymbol is reported for
+// pairs of the constructors that contain U+0000.
+func BuildExpr(ctx context.Context, e *Expr,
+	opts BuildOptions) (*RegularRelation, error) {
+
+	if err := checkSymbols(e); err != nil {
+		return nil, err
+	}
+
+	tr, err := exprTransducer(ctx, e, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rr, err := subsequentialize(ctx, tr, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.Minimize {
+		rr.Minimize()
+	}
+
+	return rr, nil
+}
+
+// subsequentialize constructs a subsequential transducer equivalent to the
+// given trim transducer.
+//
+// If the transducer has the twins property the delayed outputs of the paths
+// over the same input never differ by more than (n^2 - 1) * maxOutput symbols,
+// where n is the number of states, on top of the initial prefix. A remaining
+// output longer than that proves the property does not hold and the
+// construction would never finish.
+func subsequentialize(ctx context.Context, tr *transducer,
+	opts BuildOptions) (*RegularRelation, error) {
+
+	n := len(tr.states)
+	maxRemaining := (n*n-1)*tr.maxOutput() + utf8.RuneCountInString(tr.prefix)
+
 	stateQueue := lane.NewQueue()
 	sc := hcache.New()
 
-	initPair := &pair{state: tr.root, remaining: ""}
+	// Source state, input symbol and output through which each state was
+	// discovered.
+	type origin struct {
+		state  *sState
+		symbol rune
+		out    string
+	}
+	origins := map[*sState]origin{}
+
+	// notSubsequential describes the violation of the twins property shown
+	// by the long remaining output of p in the pairs of a new state reached
+	// from state via in with the given output.
+	notSubsequential := func(state *sState, in rune, out string, p *pair,
+		ps pairs) error {
+
+		input := []rune{in}
+		output := out
+		for s := state; s != nil; {
+			o, ok := origins[s]
+			if !ok {
+				break
+			}
+			input = append([]rune{o.symbol}, input...)
+			output = o.out + output
+			s = o.state
+		}
+
+		// The remaining outputs have no common prefix, so some pair
+		// diverges from p right away.
+		other := p
+		for _, q := range ps {
+			q := q.(*pair)
+			if q != p && lcp([][]rune{[]rune(p.remaining), []rune(q.remaining)}) == "" {
+				other = q
+				break
+			}
+		}
+
+		return &NotSubsequentialError{
+			Input:   string(input),
+			Outputs: [2]string{output + p.remaining, output + other.remaining},
+		}
+	}
+
+	initPair := &pair{state: tr.root, remaining: tr.prefix}
 	start := sc.GetOrInsert(newSState(), initPair).(*sState)
+	start.isVisited = true
 	start.remainingPairs = append(start.remainingPairs, initPair)
 	stateQueue.Enqueue(start)
+	states := 1
+
+	stopped := func(err error) error {
+		return &BuildError{States: states, Pending: stateQueue.Size(), Err: err}
+	}
+
+	// advance returns the state of the pairs of the targets with the
+	// outputs, after removing the first prefix runes the transition from
+	// state on in puts out.
+	advance := func(state *sState, in rune, out string, prefix int,
+		outputs [][]rune, targets []*tState) (*sState, error) {
+
+		// Create new pairs by removing the longest common prefix from the
+		// outputs.
+		var newPairs pairs
+		var longest *pair
+		delay := -1
+		for i, o := range outputs {
+			rest := o[prefix:]
+			p := &pair{state: targets[i], remaining: string(rest)}
+			newPairs = append(newPairs, p)
+
+			if len(rest) > delay {
+				longest, delay = p, len(rest)
+			}
+		}
+
+		if delay > maxRemaining {
+			return nil, notSubsequential(state, in, out, longest, newPairs)
+		}
+		if opts.MaxDelay > 0 && delay > opts.MaxDelay {
+			return nil, stopped(ErrDelayLimit)
+		}
+		sort.Sort(newPairs)
+
+		// Check if state with such state pairs exists...
+		nextState := sc.GetOrInsert(newSState(), newPairs...).(*sState)
+
+		// ...and populate the state with the new pairs if necessary.
+		if !nextState.isVisited {
+			if opts.MaxStates > 0 && states == opts.MaxStates {
+				return nil, stopped(ErrStateLimit)
+			}
+			states++
+
+			nextState.isVisited = true
+			nextState.remainingPairs = newPairs
+			origins[nextState] = origin{state: state, symbol: in, out: out}
+			stateQueue.Enqueue(nextState)
+		}
+
+		return nextState, nil
+	}
 
 	for stateQueue.Size() != 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, stopped(err)
+		}
+
 		state := stateQueue.Dequeue().(*sState)
 
 		// Check if state should be final and add outputs to final output.
@@ -145,55 +533,129 @@ func Build(source io.Reader) (*RegularRelation, error) {
 			state.finalOut = append(state.finalOut, final...)
 		}
 
-		// Get groups of pairs that have states with same input symbol.
-		withInput := make(map[rune]pairs)
+		// Get the input symbols of the transitions of the pairs and the
+		// bounds of the ranges of their character classes.
+		symbols := map[rune]bool{}
+		var cuts []rune
 		for _, p := range state.remainingPairs {
 			p := p.(*pair)
 			for in := range p.state.next {
-				withInput[in] = append(withInput[in], p)
+				symbols[in] = true
+				cuts = append(cuts, in, in+1)
+			}
+			for _, c := range p.state.classes {
+				for _, r := range c.class {
+					cuts = append(cuts, r.lo, r.hi+1)
+				}
 			}
 		}
 
-		for in, ps := range withInput {
-			// Get all remaining+out strings from states with given input
-			// and map them to corresponding next state.
+		// symbol adds the transition on the single input symbol in. All
+		// remaining+out strings of the transitions on it are mapped to the
+		// corresponding next state.
+		symbol := func(in rune) error {
 			var outputs [][]rune
-			nextStates := make(map[int]*tState)
-			for _, p := range ps {
+			var targets []*tState
+			for _, p := range state.remainingPairs {
 				p := p.(*pair)
-				remaining := bytes.Runes([]byte(p.remaining))
+				remaining := []rune(p.remaining)
 				for _, o := range p.state.next[in] {
-					out := append(remaining, bytes.Runes([]byte(o.out))...)
-					outputs = append(outputs, out)
-					nextStates[len(outputs)-1] = o.state
+					outputs = append(outputs, joined(remaining, []rune(o.out)))
+					targets = append(targets, o.state)
+				}
+				for _, c := range p.state.classes {
+					if c.class.contains(in) {
+						out := fill(c.out, c.identity, in)
+						outputs = append(outputs, joined(remaining, []rune(out)))
+						targets = append(targets, c.state)
+					}
 				}
 			}
 
 			// Calculate longest common prefix.
-			state.out[in] = lcp(outputs)
+			prefix := commonPrefix(outputs)
+			out := string(prefix)
 
-			// Create new pairs by removing the longest common prefix from
-			// the outputs.
-			var newPairs pairs
-			for i, out := range outputs {
-				newPairs = append(newPairs, &pair{
-					state:     nextStates[i],
-					remaining: string(out[len(state.out[in]):]),
-				})
+			next, err := advance(state, in, out, len(prefix), outputs, targets)
+			if err != nil {
+				return err
 			}
-			sort.Sort(newPairs)
+			state.next[in] = next
+			state.out[in] = out
+			return nil
+		}
+
+		for in := range symbols {
+			if err := symbol(in); err != nil {
+				return nil, err
+			}
+		}
 
-			// Check if state with such state pairs exists...
-			nextState := sc.GetOrInsert(newSState(), newPairs...).(*sState)
+		// Symbols between two consecutive cuts are in the same classes, so
+		// they share one transition unless the output delayed after it
+		// depends on the symbol. Then the symbol has to be remembered in
+		// the state, so each symbol gets its own transition and state, up
+		// to maxSplit symbols per state.
+		sort.Slice(cuts, func(i, j int) bool { return cuts[i] < cuts[j] })
+		var splits []runeRange
+		splitSymbols := 0
+		for i := 0; i+1 < len(cuts); i++ {
+			lo, hi := cuts[i], cuts[i+1]-1
+			if lo > hi || symbols[lo] {
+				continue
+			}
 
-			// ...and populate the state with the new pairs if necessary.
-			if !nextState.isVisited {
-				nextState.isVisited = true
-				nextState.remainingPairs = newPairs
-				stateQueue.Enqueue(nextState)
+			var outputs [][]rune
+			var targets []*tState
+			for _, p := range state.remainingPairs {
+				p := p.(*pair)
+				for _, c := range p.state.classes {
+					if c.class.contains(lo) {
+						out := template(c.out, c.identity)
+						outputs = append(outputs, joined([]rune(p.remaining), out))
+						targets = append(targets, c.state)
+					}
+				}
+			}
+			if len(outputs) == 0 {
+				continue
 			}
 
-			state.next[in] = nextState
+			prefix := commonPrefix(outputs)
+			split := lo == hi
+			for _, o := range outputs {
+				split = split || hasPlaceholder(o[len(prefix):])
+			}
+			if split {
+				splits = append(splits, runeRange{lo, hi})
+				if splitSymbols += int(hi-lo) + 1; splitSymbols > maxSplit {
+					return nil, fmt.Errorf("%w: more than %d symbols need their own states",
+						ErrWideClass, maxSplit)
+				}
+				continue
+			}
+
+			out, identity := fromTemplate(prefix)
+			next, err := advance(state, lo, fill(out, identity, lo), len(prefix),
+				outputs, targets)
+			if err != nil {
+				return nil, err
+			}
+			state.ranges = append(state.ranges, &sRange{
+				lo:       lo,
+				hi:       hi,
+				next:     next,
+				out:      out,
+				identity: identity,
+			})
+		}
+
+		for _, r := range splits {
+			for in := r.lo; in <= r.hi; in++ {
+				if err := symbol(in); err != nil {
+					return nil, err
+				}
+			}
 		}
 	}
 
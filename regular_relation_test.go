@@ -1,8 +1,12 @@
 package relations
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
+	"unicode"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -38,3 +42,241 @@ func TestSubsequentialTransducerStructure(t *testing.T) {
 		assert.Equal(t, 1, len(state4.next))
 	})
 }
+
+func TestNotSubsequential(t *testing.T) {
+	_, err := Build(strings.NewReader(`(<a,x>*.<b,>)+(<a,y>*.<c,>)`))
+	assert.True(t, errors.Is(err, ErrNotSubsequential))
+
+	notSubsequential, ok := err.(*NotSubsequentialError)
+	if assert.True(t, ok) {
+		input := notSubsequential.Input
+		assert.Equal(t, strings.Repeat("a", len(input)), input)
+		assert.ElementsMatch(t, []string{
+			strings.Repeat("x", len(input)),
+			strings.Repeat("y", len(input)),
+		}, notSubsequential.Outputs[:])
+	}
+}
+
+func TestSubsequentialWithCycles(t *testing.T) {
+	rr, err := Build(strings.NewReader(`(<a,x>+<b,y>)*.<c,z>`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("abbac")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"xyyxz"}, out)
+}
+
+func TestDelayedOutputWithCycles(t *testing.T) {
+	rr, err := Build(strings.NewReader(`(<a,x>.<b,>*.<c,>)+(<a,y>.<b,>*.<d,>)`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("abbd")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"y"}, out)
+}
+
+func TestLoopToStart(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<a,x>*`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("aa")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"xx"}, out)
+}
+
+func TestBuildStateLimit(t *testing.T) {
+	_, err := BuildWithOptions(context.Background(),
+		strings.NewReader(`<abc,x>+<abd,y>+<bcd,z>`), BuildOptions{MaxStates: 3})
+	assert.True(t, errors.Is(err, ErrStateLimit))
+
+	buildErr, ok := err.(*BuildError)
+	if assert.True(t, ok) {
+		assert.Equal(t, 3, buildErr.States)
+	}
+}
+
+func TestBuildDelayLimit(t *testing.T) {
+	source := `(<ab,xyz>.<c,>)+(<ab,uvw>.<d,>)`
+
+	_, err := BuildWithOptions(context.Background(),
+		strings.NewReader(source), BuildOptions{MaxDelay: 2})
+	assert.True(t, errors.Is(err, ErrDelayLimit))
+
+	_, err = BuildWithOptions(context.Background(),
+		strings.NewReader(source), BuildOptions{MaxDelay: 3})
+	assert.Nil(t, err)
+}
+
+func TestBuildCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := BuildWithOptions(ctx,
+		strings.NewReader(`<abc,xyz>`), BuildOptions{})
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	buildErr, ok := err.(*BuildError)
+	if assert.True(t, ok) {
+		assert.Equal(t, 1, buildErr.States)
+		assert.Equal(t, 1, buildErr.Pending)
+	}
+}
+
+func TestBuildExpressionTransducerLimits(t *testing.T) {
+	// The positions of the expression give a state for each of the 2^19
+	// combinations of the last symbols read.
+	source := `(<a,x>+<b,x>)*<a,x>(<a,x>+<b,x>){18}`
+
+	start := time.Now()
+	_, err := BuildWithOptions(context.Background(),
+		strings.NewReader(source), BuildOptions{MaxStates: 100})
+	assert.True(t, errors.Is(err, ErrStateLimit))
+
+	buildErr, ok := err.(*BuildError)
+	if assert.True(t, ok) {
+		assert.Equal(t, 100, buildErr.States)
+		assert.NotZero(t, buildErr.Pending)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = BuildWithOptions(ctx, strings.NewReader(source), BuildOptions{})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	buildErr, ok = err.(*BuildError)
+	if assert.True(t, ok) {
+		assert.Greater(t, buildErr.States, 1)
+	}
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestQuantifiers(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<d,D>{1,3}(<\,,>(<d,D>{3}))^?<s,S>`))
+	assert.Nil(t, err)
+
+	for input, expected := range map[string]string{
+		"ds":           "DS",
+		"ddds":         "DDDS",
+		"dd,ddds":      "DDDDDS",
+		"d,ddd,ddd,ds": "",
+		"dddds":        "",
+		"d,dds":        "",
+	} {
+		out, ok := rr.Transduce(input)
+		if expected == "" {
+			assert.False(t, ok, input)
+		} else {
+			assert.Equal(t, []string{expected}, out, input)
+		}
+	}
+}
+
+func TestCharacterClasses(t *testing.T) {
+	rr, err := BuildWithOptions(context.Background(),
+		strings.NewReader(`([a-z]+<[0-9],#>+<\p{Lu},^>)*`), BuildOptions{Minimize: true})
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("ab12Жz")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ab##^z"}, out)
+
+	_, ok = rr.Transduce("a-b")
+	assert.False(t, ok)
+
+	// The classes need one transition per range instead of one per symbol.
+	states, transitions := rr.Size()
+	assert.Equal(t, 1, states)
+	assert.Equal(t, 2+len(unicodeClass(unicode.Lu)), transitions)
+}
+
+func TestNegatedClass(t *testing.T) {
+	rr, err := Build(strings.NewReader(`(<\,,;>+[^,])*`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("a,ж")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a;ж"}, out)
+}
+
+func TestIdentityWithExceptions(t *testing.T) {
+	rr, err := Build(strings.NewReader(`(<ä,ae>+<ö,oe>+<ü,ue>+<ß,ss>+[^äöüß])*`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("Grüße aus Köln")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Gruesse aus Koeln"}, out)
+}
+
+func TestClassWithDelayedSymbol(t *testing.T) {
+	// The output for the letter is only known at the end of the input.
+	rr, err := Build(strings.NewReader(`[a-c]<,>(<x,1>+<y,>)+<[a-c],z><x,2>`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("bx")
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []string{"b1", "z2"}, out)
+
+	out, ok = rr.Transduce("cy")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"c"}, out)
+}
+
+func TestWideClassWithDelayedSymbol(t *testing.T) {
+	for _, source := range []string{
+		`([^]<a,x>)+(<[^],y><b,>)`,
+		`(\p{L}<a,x>)+(<\p{L},y><b,>)`,
+	} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := Build(strings.NewReader(source))
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			assert.True(t, errors.Is(err, ErrWideClass), source)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Build(%s) did not finish", source)
+		}
+	}
+
+	rr, err := Build(strings.NewReader(`(\p{Greek}<a,x>)+(<\p{Greek},y><b,>)`))
+	assert.Nil(t, err)
+	out, ok := rr.Transduce("λa")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"λx"}, out)
+	out, ok = rr.Transduce("λb")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"y"}, out)
+}
+
+func TestInsertion(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<abc,abc>.<,->.<def,def>`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("abcdef")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"abc-def"}, out)
+
+	_, ok = rr.Transduce("abc\x00def")
+	assert.False(t, ok)
+}
+
+func TestInsertionAtEdges(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<,[>(<a,a><,!>)*<,]>`))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("aa")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"[a!a!]"}, out)
+
+	out, ok = rr.Transduce("")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"[]"}, out)
+}
+
+func TestInsertionCycle(t *testing.T) {
+	_, err := Build(strings.NewReader(`<a,a>.<,x>*`))
+	assert.True(t, errors.Is(err, ErrNotSubsequential))
+}
@@ -0,0 +1,69 @@
+package relations
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MatchMode selects which of the prefixes accepted by a relation Rewrite
+// replaces at a given position.
+type MatchMode int
+
+// Match modes supported by Rewrite.
+const (
+	LongestMatch MatchMode = iota
+	ShortestMatch
+)
+
+// Rewrite scans the text from left to right. At each position the longest or
+// shortest, depending on mode, non-empty prefix of the rest of the text that
+// is accepted by the relation is replaced with its output and the scan
+// continues after it. Runes that do not start a match are copied unchanged.
+// When the relation gives several outputs for a match the first one is used.
+func (s *RegularRelation) Rewrite(text string, mode MatchMode) string {
+	var result strings.Builder
+	var output []byte
+
+	for i := 0; i < len(text); {
+		node := s.start
+		output = append(output[:0], s.prefix...)
+
+		// End of the match and the length of its output in output.
+		matchEnd, matchOutput := -1, 0
+		var matchFinal string
+
+		for j, symbol := range text[i:] {
+			next, out, ok := node.step(symbol)
+			if !ok {
+				break
+			}
+			output = append(output, out...)
+			node = next
+
+			// A final state without final outputs gives nothing to
+			// replace the match with.
+			if node.final && len(node.finalOut) != 0 {
+				matchEnd = i + j + utf8.RuneLen(symbol)
+				matchOutput = len(output)
+				matchFinal = node.finalOut[0]
+
+				if mode == ShortestMatch {
+					break
+				}
+			}
+		}
+
+		if matchEnd < 0 {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			result.WriteString(text[i : i+size])
+			i += size
+			continue
+		}
+
+		result.Write(output[:matchOutput])
+		result.WriteString(matchFinal)
+		i = matchEnd
+	}
+
+	return result.String()
+}
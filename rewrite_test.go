@@ -0,0 +1,41 @@
+package relations
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteLongestMatch(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<sh,ш>+<s,с>+<h,х>+<ch,ч>`))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "шeсt чeсс, ok?",
+		rr.Rewrite("shest chess, ok?", LongestMatch))
+}
+
+func TestRewriteShortestMatch(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<a,x>.<a,y>*`))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "bxyyb", rr.Rewrite("baaab", LongestMatch))
+	assert.Equal(t, "bxxxb", rr.Rewrite("baaab", ShortestMatch))
+}
+
+func TestRewriteSkipsEmptyMatch(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<ab,X>*`))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "XXa-X", rr.Rewrite("ababa-ab", LongestMatch))
+}
+
+func TestRewriteWithoutFinalOutputs(t *testing.T) {
+	end := newSState()
+	end.final = true
+	start := newSState()
+	start.next['a'], start.out['a'] = end, "x"
+	rr := &RegularRelation{start: start}
+
+	assert.Equal(t, "bab", rr.Rewrite("bab", LongestMatch))
+}
@@ -0,0 +1,312 @@
+package relations
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"unicode/utf8"
+)
+
+// The binary format of a RegularRelation is:
+//
+//	magic    "RREL"
+//	version  byte
+//	prefix   string
+//	states   uvarint count, followed by the states
+//	checksum CRC-32 (IEEE) of everything before it, big-endian
+//
+// where each state is
+//
+//	final        byte, 1 if the state is final and 0 otherwise
+//	finalOut     uvarint count, followed by the strings
+//	transitions  uvarint count, followed by (uvarint symbol,
+//	             uvarint target state, string output) triples
+//	ranges       uvarint count, followed by (uvarint lo, uvarint hi,
+//	             uvarint target state, string output, uvarint identity)
+//	             tuples, identity being one more than the byte offset of
+//	             the symbol read in the output, or 0 if it is absent
+//
+// and each string is its uvarint length in bytes followed by the bytes.
+// States are numbered in the order they are written, the first one being
+// the start state. Version 1 of the format has no ranges.
+const (
+	formatMagic   = "RREL"
+	formatVersion = 2
+)
+
+// Errors reported by ReadRelation.
+var (
+	ErrInvalidFormat      = errors.New("invalid relation data")
+	ErrUnsupportedVersion = errors.New("unsupported relation format version")
+)
+
+// encoder writes the primitives of the binary format.
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.WriteString(s)
+}
+
+// WriteTo writes the transducer to w in a compact binary format that can be
+// read back by ReadRelation.
+func (s *RegularRelation) WriteTo(w io.Writer) (int64, error) {
+	states := s.states()
+	index := map[*sState]int{}
+	for i, state := range states {
+		index[state] = i
+	}
+
+	e := &encoder{}
+	e.WriteString(formatMagic)
+	e.WriteByte(formatVersion)
+	e.string(s.prefix)
+
+	e.uvarint(uint64(len(states)))
+	for _, state := range states {
+		if state.final {
+			e.WriteByte(1)
+		} else {
+			e.WriteByte(0)
+		}
+
+		e.uvarint(uint64(len(state.finalOut)))
+		for _, o := range state.finalOut {
+			e.string(o)
+		}
+
+		e.uvarint(uint64(len(state.next)))
+		for _, symbol := range state.symbols() {
+			e.uvarint(uint64(symbol))
+			e.uvarint(uint64(index[state.next[symbol]]))
+			e.string(state.out[symbol])
+		}
+
+		e.uvarint(uint64(len(state.ranges)))
+		for _, r := range state.ranges {
+			e.uvarint(uint64(r.lo))
+			e.uvarint(uint64(r.hi))
+			e.uvarint(uint64(index[r.next]))
+			e.string(r.out)
+			e.uvarint(uint64(r.identity + 1))
+		}
+	}
+
+	var checksum [4]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(e.Bytes()))
+	e.Write(checksum[:])
+
+	return e.WriteTo(w)
+}
+
+// decoder reads the primitives of the binary format and remembers the first
+// error it encounters.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrInvalidFormat, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) == 0 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail("malformed number")
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return v
+}
+
+// count reads a number of elements, each of which takes at least one byte.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail("count %d exceeds the remaining data", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.data)) {
+		d.fail("string length %d exceeds the remaining data", n)
+		return ""
+	}
+
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+// ranges reads the range transitions of the state, checking that they are
+// sorted and do not overlap with each other or the single symbols.
+func (d *decoder) ranges(state *sState, states []*sState) {
+	n := d.count()
+	for i := 0; i < n; i++ {
+		lo, hi, target := d.uvarint(), d.uvarint(), d.uvarint()
+		out, identity := d.string(), d.uvarint()
+		if d.err != nil {
+			return
+		}
+
+		switch {
+		case lo > hi || hi > utf8.MaxRune:
+			d.fail("invalid range %d-%d", lo, hi)
+		case len(state.ranges) != 0 && rune(lo) <= state.ranges[len(state.ranges)-1].hi:
+			d.fail("unsorted range %d-%d", lo, hi)
+		case target >= uint64(len(states)):
+			d.fail("transition to missing state %d", target)
+		case identity > uint64(len(out)+1) ||
+			identity > 0 && !utf8.RuneStart(append([]byte(out), 0)[identity-1]):
+			d.fail("invalid identity offset %d", identity)
+		}
+		if d.err != nil {
+			return
+		}
+
+		for symbol := range state.next {
+			if symbol >= rune(lo) && symbol <= rune(hi) {
+				d.fail("duplicate transition on %q", symbol)
+				return
+			}
+		}
+
+		state.ranges = append(state.ranges, &sRange{
+			lo:       rune(lo),
+			hi:       rune(hi),
+			next:     states[target],
+			out:      out,
+			identity: int(identity) - 1,
+		})
+	}
+}
+
+// ReadRelation reads a transducer written by WriteTo. Data that is corrupt
+// is reported with ErrInvalidFormat and data written by a newer version of
+// the format with ErrUnsupportedVersion.
+func ReadRelation(r io.Reader) (*RegularRelation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header := len(formatMagic) + 1
+	if len(data) < header+4 || string(data[:len(formatMagic)]) != formatMagic {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidFormat)
+	}
+	version := data[len(formatMagic)]
+	if version == 0 || version > formatVersion {
+		return nil, fmt.Errorf("%w %d, expected at most %d",
+			ErrUnsupportedVersion, version, formatVersion)
+	}
+
+	body, checksum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(checksum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidFormat)
+	}
+
+	d := &decoder{data: body[header:]}
+	prefix := d.string()
+
+	n := d.count()
+	if d.err == nil && n == 0 {
+		d.fail("no start state")
+	}
+
+	states := make([]*sState, n)
+	for i := range states {
+		states[i] = newSState()
+	}
+
+	for _, state := range states {
+		switch d.byte() {
+		case 0:
+		case 1:
+			state.final = true
+		default:
+			d.fail("malformed final flag")
+		}
+
+		finalOut := d.count()
+		for i := 0; i < finalOut; i++ {
+			state.finalOut = append(state.finalOut, d.string())
+		}
+		if d.err == nil && state.final != (finalOut != 0) {
+			d.fail("final outputs do not match the final flag")
+		}
+
+		transitions := d.count()
+		for i := 0; i < transitions; i++ {
+			symbol, target, out := d.uvarint(), d.uvarint(), d.string()
+			if d.err != nil {
+				break
+			}
+
+			if symbol > utf8.MaxRune {
+				d.fail("invalid symbol %d", symbol)
+			} else if target >= uint64(n) {
+				d.fail("transition to missing state %d", target)
+			} else if _, ok := state.next[rune(symbol)]; ok {
+				d.fail("duplicate transition on %q", rune(symbol))
+			} else {
+				state.next[rune(symbol)] = states[target]
+				state.out[rune(symbol)] = out
+			}
+		}
+
+		if version > 1 {
+			d.ranges(state, states)
+		}
+
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+
+	if d.err == nil && len(d.data) != 0 {
+		d.fail("%d trailing bytes", len(d.data))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &RegularRelation{start: states[0], prefix: prefix}, nil
+}
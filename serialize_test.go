@@ -0,0 +1,165 @@
+package relations
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serializedRelation(t *testing.T, regexp string) []byte {
+	rr, err := Build(strings.NewReader(regexp))
+	assert.Nil(t, err)
+
+	var b bytes.Buffer
+	n, err := rr.WriteTo(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(b.Len()), n)
+
+	return b.Bytes()
+}
+
+// withChecksum replaces the checksum of the serialized data.
+func withChecksum(data []byte) []byte {
+	body := data[:len(data)-4]
+	binary.BigEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(body))
+	return data
+}
+
+func TestSerializationRoundTrip(t *testing.T) {
+	data := serializedRelation(t, `(<ab,x>+<aж,yz>).(<c,>+<d,w>)*`)
+
+	rr, err := ReadRelation(bytes.NewReader(data))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("aжcc")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"yz"}, out)
+
+	_, ok = rr.Transduce("ac")
+	assert.False(t, ok)
+}
+
+func TestSerializationKeepsPrefix(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<a,xy>+<b,xz>`))
+	assert.Nil(t, err)
+	rr.Minimize()
+
+	var b bytes.Buffer
+	_, err = rr.WriteTo(&b)
+	assert.Nil(t, err)
+
+	read, err := ReadRelation(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, "x", read.prefix)
+
+	out, ok := read.Transduce("b")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"xz"}, out)
+}
+
+func TestReadCorruptRelation(t *testing.T) {
+	data := serializedRelation(t, `<abc,xyz>`)
+	data[len(data)/2] ^= 0xff
+
+	_, err := ReadRelation(bytes.NewReader(data))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	assert.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestReadTruncatedRelation(t *testing.T) {
+	data := serializedRelation(t, `<abc,xyz>`)
+	data = withChecksum(append(data[:len(data)-8], 0, 0, 0, 0))
+
+	_, err := ReadRelation(bytes.NewReader(data))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestReadDanglingTransition(t *testing.T) {
+	var e encoder
+	e.WriteString(formatMagic)
+	e.WriteByte(formatVersion)
+	e.string("")
+	e.uvarint(1)
+	e.WriteByte(0)
+	e.uvarint(0)
+	e.uvarint(1)
+	e.uvarint('a')
+	e.uvarint(7)
+	e.string("x")
+	e.Write(make([]byte, 4))
+
+	_, err := ReadRelation(bytes.NewReader(withChecksum(e.Bytes())))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	assert.Contains(t, err.Error(), "missing state 7")
+}
+
+func TestReadFinalWithoutOutputs(t *testing.T) {
+	var e encoder
+	e.WriteString(formatMagic)
+	e.WriteByte(formatVersion)
+	e.string("")
+	e.uvarint(1)
+	e.WriteByte(1)
+	e.uvarint(0)
+	e.uvarint(0)
+	e.Write(make([]byte, 4))
+
+	_, err := ReadRelation(bytes.NewReader(withChecksum(e.Bytes())))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	assert.Contains(t, err.Error(), "final outputs do not match the final flag")
+}
+
+func TestReadFutureVersion(t *testing.T) {
+	data := serializedRelation(t, `<abc,xyz>`)
+	data[len(formatMagic)] = formatVersion + 1
+
+	_, err := ReadRelation(bytes.NewReader(withChecksum(data)))
+	assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+}
+
+func TestReadMissingHeader(t *testing.T) {
+	_, err := ReadRelation(strings.NewReader("<abc,xyz>"))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestSerializationRanges(t *testing.T) {
+	data := serializedRelation(t, `([a-z]+<[0-9],#>)*<.,!>`)
+
+	rr, err := ReadRelation(bytes.NewReader(data))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("ab12.")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ab##!"}, out)
+}
+
+func TestReadFirstVersion(t *testing.T) {
+	var e encoder
+	e.WriteString(formatMagic)
+	e.WriteByte(1)
+	e.string("")
+	e.uvarint(2)
+	e.WriteByte(0)
+	e.uvarint(0)
+	e.uvarint(1)
+	e.uvarint('a')
+	e.uvarint(1)
+	e.string("x")
+	e.WriteByte(1)
+	e.uvarint(1)
+	e.string("")
+	e.uvarint(0)
+	e.Write(make([]byte, 4))
+
+	rr, err := ReadRelation(bytes.NewReader(withChecksum(e.Bytes())))
+	assert.Nil(t, err)
+
+	out, ok := rr.Transduce("a")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"x"}, out)
+}
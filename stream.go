@@ -0,0 +1,71 @@
+package relations
+
+import (
+	"fmt"
+	"io"
+)
+
+// RejectError reports the position at which the input of TransduceStream
+// left the domain of the relation.
+type RejectError struct {
+	Offset int64 // byte offset of the rejected rune or the length of the input
+	Rune   rune  // rejected rune, meaningless when AtEOF is set
+	AtEOF  bool  // the input ended in a state that is not final
+}
+
+func (e *RejectError) Error() string {
+	if e.AtEOF {
+		return fmt.Sprintf("input rejected at byte %d: unexpected end of input",
+			e.Offset)
+	}
+	return fmt.Sprintf("input rejected at byte %d: unexpected %q", e.Offset, e.Rune)
+}
+
+// TransduceStream feeds the runes read from r into the transducer and writes
+// the output to w as soon as it is determined, without buffering the input or
+// the output.
+//
+// At the end of the input the suffixes that complete each of the possible
+// results are returned. If there is exactly one, as is always the case for
+// functional relations, it is also written to w. A *RejectError is returned
+// if the input is not in the domain of the relation.
+func (s *RegularRelation) TransduceStream(r io.RuneReader, w io.Writer) ([]string, error) {
+	if _, err := io.WriteString(w, s.prefix); err != nil {
+		return nil, err
+	}
+
+	node := s.start
+	var offset int64
+
+	for {
+		symbol, size, err := r.ReadRune()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		next, out, ok := node.step(symbol)
+		if !ok {
+			return nil, &RejectError{Offset: offset, Rune: symbol}
+		}
+		if _, err := io.WriteString(w, out); err != nil {
+			return nil, err
+		}
+
+		node = next
+		offset += int64(size)
+	}
+
+	if !node.final {
+		return nil, &RejectError{Offset: offset, AtEOF: true}
+	}
+
+	if len(node.finalOut) == 1 {
+		if _, err := io.WriteString(w, node.finalOut[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return append([]string(nil), node.finalOut...), nil
+}
@@ -0,0 +1,46 @@
+package relations
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransduceStream(t *testing.T) {
+	rr, err := Build(strings.NewReader(`(<a,x>+<b,yy>+<ж,z>)*.<c,!>`))
+	assert.Nil(t, err)
+
+	input := strings.Repeat("abж", 1000) + "c"
+
+	var out bytes.Buffer
+	suffixes, err := rr.TransduceStream(strings.NewReader(input), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{""}, suffixes)
+	assert.Equal(t, strings.Repeat("xyyz", 1000)+"!", out.String())
+}
+
+func TestTransduceStreamSeveralOutputs(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<ab,x>+<ab,xy>`))
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	suffixes, err := rr.TransduceStream(strings.NewReader("ab"), &out)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"", "y"}, suffixes)
+	assert.Equal(t, "x", out.String())
+}
+
+func TestTransduceStreamRejected(t *testing.T) {
+	rr, err := Build(strings.NewReader(`<ab,x>*`))
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	_, err = rr.TransduceStream(strings.NewReader("abжb"), &out)
+	assert.Equal(t, &RejectError{Offset: 2, Rune: 'ж'}, err)
+	assert.EqualError(t, err, `input rejected at byte 2: unexpected 'ж'`)
+
+	_, err = rr.TransduceStream(strings.NewReader("aba"), &out)
+	assert.Equal(t, &RejectError{Offset: 3, AtEOF: true}, err)
+}
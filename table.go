@@ -0,0 +1,163 @@
+package relations
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// TableOptions describes the format of a table read by ReadTable.
+type TableOptions struct {
+	// Delimiter separates the input from the output. Zero means a tab.
+	Delimiter rune
+
+	// Comment starts lines that are skipped. Zero means no comments.
+	Comment rune
+
+	// SkipHeader skips the first row.
+	SkipHeader bool
+
+	// Quoted allows fields in double quotes as in CSV, which may contain
+	// the delimiter and line breaks and write a quote as "".
+	Quoted bool
+
+	// Dictionary controls inputs that appear in several rows.
+	Dictionary DictionaryOptions
+}
+
+// TableError reports a row of a table that could not be read.
+type TableError struct {
+	Line int // line of the row, starting from 1
+	Err  error
+}
+
+func (e *TableError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *TableError) Unwrap() error {
+	return e.Err
+}
+
+// row is a pair of a table with the line it starts on.
+type row struct {
+	in, out string
+	line    int
+}
+
+// ReadTable builds the minimal RegularRelation of a dictionary read from
+// rows of an input and an output, such as a TSV or CSV file exported from a
+// spreadsheet. The cells are taken literally, without the escaping of the
+// expression syntax. Empty lines are skipped and the rows need not be
+// sorted. A row without exactly two fields is reported with its line in a
+// *TableError.
+func ReadTable(r io.Reader, opts TableOptions) (*RegularRelation, error) {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = '\t'
+	}
+
+	var rows []row
+	var err error
+	if opts.Quoted {
+		rows, err = readQuoted(r, opts)
+	} else {
+		rows, err = readLines(r, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SkipHeader && len(rows) > 0 {
+		rows = rows[1:]
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].in < rows[j].in })
+
+	line := 0
+	rr, err := FromPairs(func(yield func(in, out string) bool) {
+		for _, r := range rows {
+			line = r.line
+			if !yield(r.in, r.out) {
+				return
+			}
+		}
+	}, opts.Dictionary)
+	if err != nil {
+		return nil, &TableError{Line: line, Err: err}
+	}
+
+	return rr, nil
+}
+
+// fields returns the row of the given fields or an error if there are not
+// exactly two of them.
+func fields(f []string, line int) (row, error) {
+	if len(f) != 2 {
+		return row{}, &TableError{
+			Line: line,
+			Err:  fmt.Errorf("expected an input and an output field, found %d", len(f)),
+		}
+	}
+	return row{in: f[0], out: f[1], line: line}, nil
+}
+
+// readLines reads rows with one line each, split at every delimiter.
+func readLines(r io.Reader, opts TableOptions) ([]row, error) {
+	var rows []row
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		text, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+		skip := text == "" ||
+			opts.Comment != 0 && strings.HasPrefix(text, string(opts.Comment))
+		if !skip {
+			row, err := fields(strings.Split(text, string(opts.Delimiter)), line)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+
+		if err == io.EOF {
+			return rows, nil
+		}
+	}
+}
+
+// readQuoted reads rows with fields that may be quoted.
+func readQuoted(r io.Reader, opts TableOptions) ([]row, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = opts.Delimiter
+	cr.Comment = opts.Comment
+	cr.FieldsPerRecord = -1
+
+	var rows []row
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &TableError{Line: parseErr.Line, Err: parseErr.Err}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		row, err := fields(record, line)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
@@ -0,0 +1,78 @@
+package relations
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testTransduce(t *testing.T, rr *RegularRelation, in string, out ...string) {
+	result, ok := rr.Transduce(in)
+	assert.True(t, ok)
+	assert.Equal(t, out, result)
+}
+
+func TestReadTable(t *testing.T) {
+	rr, err := ReadTable(strings.NewReader(
+		"walk\twalked\r\n\ntalk\ttalked\na,b\t<x>\n\"q\"\tq"), TableOptions{})
+	assert.Nil(t, err)
+
+	testTransduce(t, rr, "walk", "walked")
+	testTransduce(t, rr, "talk", "talked")
+	testTransduce(t, rr, "a,b", "<x>")
+	testTransduce(t, rr, `"q"`, "q")
+}
+
+func TestReadTableOptions(t *testing.T) {
+	source := `input,output
+# irregular verbs
+go,went
+"a,b","say ""hi"""
+go,gone
+`
+	rr, err := ReadTable(strings.NewReader(source), TableOptions{
+		Delimiter:  ',',
+		Comment:    '#',
+		SkipHeader: true,
+		Quoted:     true,
+	})
+	assert.Nil(t, err)
+
+	testTransduce(t, rr, "go", "gone", "went")
+	testTransduce(t, rr, "a,b", `say "hi"`)
+	_, ok := rr.Transduce("input")
+	assert.False(t, ok)
+}
+
+func TestReadTableMalformedRow(t *testing.T) {
+	_, err := ReadTable(strings.NewReader("a\tb\n# c\nc\n"),
+		TableOptions{Comment: '#'})
+	tableErr, ok := err.(*TableError)
+	assert.True(t, ok)
+	assert.Equal(t, 3, tableErr.Line)
+	assert.Equal(t, "line 3: expected an input and an output field, found 1", err.Error())
+
+	_, err = ReadTable(strings.NewReader("a;b\n\"c;d\";e;f\n"),
+		TableOptions{Delimiter: ';', Quoted: true})
+	tableErr, ok = err.(*TableError)
+	assert.True(t, ok)
+	assert.Equal(t, 2, tableErr.Line)
+
+	_, err = ReadTable(strings.NewReader("a,b\n\"c\n\nd,e\n"),
+		TableOptions{Delimiter: ',', Quoted: true})
+	tableErr, ok = err.(*TableError)
+	assert.True(t, ok)
+	assert.Equal(t, 4, tableErr.Line)
+}
+
+func TestReadTableDuplicates(t *testing.T) {
+	source := "go\twent\nwalk\twalked\ngo\tgone\n"
+	_, err := ReadTable(strings.NewReader(source),
+		TableOptions{Dictionary: DictionaryOptions{RejectDuplicates: true}})
+	tableErr, ok := err.(*TableError)
+	assert.True(t, ok)
+	assert.Equal(t, 3, tableErr.Line)
+	assert.True(t, errors.Is(err, ErrDuplicateInput))
+}
@@ -1,8 +1,11 @@
 package relations
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"sort"
+	"unicode/utf8"
 
 	"github.com/oleiade/lane"
 	"github.com/s2gatev/hcache"
@@ -24,17 +27,34 @@ func (ps positions) Swap(i, j int) {
 	ps[i], ps[j] = ps[j], ps[i]
 }
 
+// epsilon is the input symbol of transitions that consume no input.
+const epsilon = 0
+
 // tTransition keeps the destination state and its output.
 type tTransition struct {
 	state *tState
 	out   string
 }
 
-// tState is a state in a transducer. Each has a unique index.
+// tClassTransition consumes any symbol of a character class. Its output is
+// out with the symbol read inserted at the byte offset identity, unless
+// identity is negative.
+type tClassTransition struct {
+	class    charClass
+	state    *tState
+	out      string
+	identity int
+}
+
+// tState is a state in a transducer. Each has a unique index. The outputs
+// appended when the input ends in a final state are listed in finalOut, none
+// meaning the empty output.
 type tState struct {
-	index int
-	next  map[rune][]*tTransition
-	final bool
+	index    int
+	next     map[rune][]*tTransition
+	classes  []*tClassTransition
+	final    bool
+	finalOut []string
 }
 
 // keysAsPositions wraps the given set in a sorted positions struct.
@@ -49,17 +69,246 @@ func keysAsPositions(s set) positions {
 }
 
 // transducer contains the initial state of the transducer constructed from
-// the parsed regular expression.
+// the parsed regular expression and all of its states ordered by index.
+// The prefix is output before reading any input.
 type transducer struct {
-	root *tState
+	root   *tState
+	states []*tState
+	prefix string
+}
+
+// trim removes the states from which no final state can be reached together
+// with the transitions leading to them, as well as the states that can not
+// be reached from the root.
+func (t *transducer) trim() {
+	// Reverse transitions: state index -> source states.
+	incoming := map[int][]*tState{}
+	for _, state := range t.states {
+		for _, transitions := range state.next {
+			for _, tr := range transitions {
+				incoming[tr.state.index] = append(incoming[tr.state.index], state)
+			}
+		}
+		for _, c := range state.classes {
+			incoming[c.state.index] = append(incoming[c.state.index], state)
+		}
+	}
+
+	coaccessible := newSet()
+	unmarked := lane.NewQueue()
+	for _, state := range t.states {
+		if state.final {
+			coaccessible.add(state.index)
+			unmarked.Enqueue(state)
+		}
+	}
+	for unmarked.Size() != 0 {
+		state := unmarked.Dequeue().(*tState)
+		for _, source := range incoming[state.index] {
+			if !coaccessible.contains(source.index) {
+				coaccessible.add(source.index)
+				unmarked.Enqueue(source)
+			}
+		}
+	}
+
+	for _, state := range t.states {
+		for in, transitions := range state.next {
+			var kept []*tTransition
+			for _, tr := range transitions {
+				if coaccessible.contains(tr.state.index) {
+					kept = append(kept, tr)
+				}
+			}
+
+			if len(kept) == 0 {
+				delete(state.next, in)
+			} else {
+				state.next[in] = kept
+			}
+		}
+
+		var kept []*tClassTransition
+		for _, c := range state.classes {
+			if coaccessible.contains(c.state.index) {
+				kept = append(kept, c)
+			}
+		}
+		state.classes = kept
+	}
+
+	accessible := newSet(t.root.index)
+	unmarked.Enqueue(t.root)
+	for unmarked.Size() != 0 {
+		state := unmarked.Dequeue().(*tState)
+
+		var targets []*tState
+		for _, transitions := range state.next {
+			for _, tr := range transitions {
+				targets = append(targets, tr.state)
+			}
+		}
+		for _, c := range state.classes {
+			targets = append(targets, c.state)
+		}
+
+		for _, target := range targets {
+			if !accessible.contains(target.index) {
+				accessible.add(target.index)
+				unmarked.Enqueue(target)
+			}
+		}
+	}
+
+	var states []*tState
+	for _, state := range t.states {
+		if accessible.contains(state.index) {
+			states = append(states, state)
+		}
+	}
+	t.states = states
+}
+
+// removeEpsilons replaces the transitions on epsilon by transitions that
+// consume the input symbol following them and carry the outputs of the whole
+// path. The outputs of epsilon paths leading to final states become final
+// outputs. Epsilon cycles with non-empty output are reported as
+// ErrNotSubsequential, since they give infinitely many outputs for one input.
+func (t *transducer) removeEpsilons() error {
+	// Without cycles with output, epsilon paths give no more than this.
+	maxClosure := len(t.states) * t.maxOutput()
+
+	type reach struct {
+		state *tState
+		out   string
+	}
+
+	next := map[int]map[rune][]*tTransition{}
+	classes := map[int][]*tClassTransition{}
+	finalOut := map[int][]string{}
+
+	for _, state := range t.states {
+		// Collect the states reachable via epsilon transitions.
+		closure := []reach{{state, ""}}
+		seen := map[reach]bool{closure[0]: true}
+		for i := 0; i < len(closure); i++ {
+			for _, tr := range closure[i].state.next[epsilon] {
+				r := reach{tr.state, closure[i].out + tr.out}
+				if utf8.RuneCountInString(r.out) > maxClosure {
+					return fmt.Errorf("%w: epsilon cycle with output %q",
+						ErrNotSubsequential, r.out)
+				}
+				if !seen[r] {
+					seen[r] = true
+					closure = append(closure, r)
+				}
+			}
+		}
+
+		type arc struct {
+			in rune
+			tTransition
+		}
+		transitions := map[rune][]*tTransition{}
+		added := map[arc]bool{}
+		var final []string
+		for _, r := range closure {
+			for in, trs := range r.state.next {
+				if in == epsilon {
+					continue
+				}
+				for _, tr := range trs {
+					tr := tTransition{state: tr.state, out: r.out + tr.out}
+					if !added[arc{in, tr}] {
+						added[arc{in, tr}] = true
+						transitions[in] = append(transitions[in], &tr)
+					}
+				}
+			}
+			for _, c := range r.state.classes {
+				identity := c.identity
+				if identity >= 0 {
+					identity += len(r.out)
+				}
+				classes[state.index] = append(classes[state.index], &tClassTransition{
+					class:    c.class,
+					state:    c.state,
+					out:      r.out + c.out,
+					identity: identity,
+				})
+			}
+
+			if !r.state.final {
+				continue
+			}
+			if len(r.state.finalOut) == 0 {
+				final = append(final, r.out)
+			}
+			for _, o := range r.state.finalOut {
+				final = append(final, r.out+o)
+			}
+		}
+
+		next[state.index] = transitions
+		finalOut[state.index] = finalOutSet(final)
+	}
+
+	for _, state := range t.states {
+		state.next = next[state.index]
+		state.classes = classes[state.index]
+		state.finalOut = finalOut[state.index]
+		state.final = len(state.finalOut) != 0
+	}
+
+	t.trim()
+	return nil
+}
+
+// hasEpsilons reports whether any state has transitions on epsilon.
+func (t *transducer) hasEpsilons() bool {
+	for _, state := range t.states {
+		if len(state.next[epsilon]) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// maxOutput returns the length in runes of the longest transition output.
+func (t *transducer) maxOutput() int {
+	max := 0
+	for _, state := range t.states {
+		for _, transitions := range state.next {
+			for _, tr := range transitions {
+				if n := utf8.RuneCountInString(tr.out); n > max {
+					max = n
+				}
+			}
+		}
+		for _, c := range state.classes {
+			if n := outputLen(c.out, c.identity); n > max {
+				max = n
+			}
+		}
+	}
+	return max
 }
 
 // newTransducer constructs a new transducer from input reader.
 func newTransducer(source io.Reader) (*transducer, error) {
-	meta, err := computeParserMeta(source)
+	e, err := Parse(source)
 	if err != nil {
 		return nil, err
 	}
+	return exprTransducer(context.Background(), e, BuildOptions{})
+}
+
+// exprTransducer constructs a new transducer from the expression. It has a
+// state for each set of positions that can be reached, which may be
+// exponentially many, so it stops with a *BuildError when the context is
+// done or there are more than opts.MaxStates of them.
+func exprTransducer(ctx context.Context, e *Expr, opts BuildOptions) (*transducer, error) {
+	meta := exprParserMeta(e)
 
 	states := map[int]*tState{} // state index -> state
 	positions := map[int]set{}  // state index -> positions
@@ -83,10 +332,19 @@ func newTransducer(source io.Reader) (*transducer, error) {
 		return state
 	}
 
+	stopped := func(err error) error {
+		return &BuildError{States: index, Pending: unmarked.Size(), Err: err}
+	}
+
 	root := addState(meta.rootFirst)
+	root.final = meta.rootFirst.contains(meta.finalIndex)
 	unmarked.Enqueue(root)
 
 	for unmarked.Size() != 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, stopped(err)
+		}
+
 		state := unmarked.Dequeue().(*tState)
 
 		// Get union of follow for positions in the state than correspond
@@ -115,6 +373,9 @@ func newTransducer(source io.Reader) (*transducer, error) {
 
 			// ...otherwise create new state.
 			if nextState == nil {
+				if opts.MaxStates > 0 && index == opts.MaxStates {
+					return nil, stopped(ErrStateLimit)
+				}
 				nextState = addState(union)
 				if union.contains(meta.finalIndex) {
 					nextState.final = true
@@ -123,10 +384,38 @@ func newTransducer(source io.Reader) (*transducer, error) {
 			}
 
 			// Add transitions.
-			state.next[symb.in] = append(state.next[symb.in],
-				&tTransition{state: nextState, out: symb.out})
+			if symb.class == 0 {
+				state.next[symb.in] = append(state.next[symb.in],
+					&tTransition{state: nextState, out: symb.out})
+				continue
+			}
+
+			identity := -1
+			if symb.identity {
+				identity = 0
+			}
+			state.classes = append(state.classes, &tClassTransition{
+				class:    meta.classes[symb.class-1],
+				state:    nextState,
+				out:      symb.out,
+				identity: identity,
+			})
+		}
+	}
+
+	tr := &transducer{root: root}
+	for i := 1; i <= index; i++ {
+		tr.states = append(tr.states, states[i])
+	}
+	tr.trim()
+
+	// Pairs with empty input, such as the insertion <,x>, give transitions
+	// on epsilon whose outputs move to the following transitions.
+	if tr.hasEpsilons() {
+		if err := tr.removeEpsilons(); err != nil {
+			return nil, err
 		}
 	}
 
-	return &transducer{root: root}, nil
+	return tr, nil
 }
@@ -81,3 +81,34 @@ func TestMulticharInputTransducer(t *testing.T) {
 		assert.Equal(t, 2, len(state1.next['a']))
 	})
 }
+
+func TestInsertionsMoveToNextTransition(t *testing.T) {
+	testTransducer(`<a,x><,y><b,z>`, func(tr *transducer) {
+		for _, state := range tr.states {
+			assert.Empty(t, state.next[epsilon])
+		}
+
+		a := tr.root.next['a']
+		if assert.Len(t, a, 1) {
+			assert.Equal(t, "x", a[0].out)
+			b := a[0].state.next['b']
+			if assert.Len(t, b, 1) {
+				assert.Equal(t, "yz", b[0].out)
+			}
+		}
+	})
+}
+
+func TestRemoveEpsilonsKeepsSymbols(t *testing.T) {
+	root := &tState{index: 1, next: map[rune][]*tTransition{}}
+	middle := &tState{index: 2, next: map[rune][]*tTransition{}}
+	end := &tState{index: 3, final: true}
+	root.next[epsilon] = []*tTransition{{state: middle, out: "x"}}
+	middle.next['a'] = []*tTransition{{state: end}}
+	middle.next['b'] = []*tTransition{{state: end}}
+
+	tr := &transducer{root: root, states: []*tState{root, middle, end}}
+	assert.Nil(t, tr.removeEpsilons())
+	assert.Len(t, root.next['a'], 1)
+	assert.Len(t, root.next['b'], 1)
+}